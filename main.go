@@ -1,6 +1,15 @@
 package main
 
 import (
+	"encoding/json"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/zetaoss/runbox/pkg/cache"
 	"github.com/zetaoss/runbox/pkg/handler"
 	"github.com/zetaoss/runbox/pkg/runner/box"
 	"github.com/zetaoss/runbox/pkg/runner/lang"
@@ -9,10 +18,142 @@ import (
 )
 
 func main() {
-	d := testutil.NewDocker()
-	b := box.New(d)
+	box.RunNativeInit()
+	b := newBox()
+	setupLimits(b)
+	if v := os.Getenv("RUNBOX_MAX_RUNS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("RUNBOX_MAX_RUNS err: %v", err)
+		}
+		b.SetMaxRuns(n)
+	}
+	if len(os.Args) > 2 && os.Args[1] == "populate-cache" {
+		populateCache(b, os.Args[2])
+		return
+	}
 	langRunner := lang.New(b)
+	setupRegistry(langRunner)
+	if os.Getenv("RUNBOX_CACHES") == "1" {
+		langRunner.SetCaches(cache.Defaults)
+		langRunner.SetEnvs(cache.NewEnvs(b, cache.Defaults))
+	}
+	if os.Getenv("RUNBOX_BACKEND") != "native" {
+		setupRuntimes(b, langRunner)
+	}
 	notebookRunner := notebook.New(b)
 	r := handler.New(langRunner, notebookRunner)
+	r.SetReadyConfig(readyConfig())
 	_ = r.Run(":8080")
 }
+
+func newBox() *box.Box {
+	if os.Getenv("RUNBOX_BACKEND") != "native" {
+		return box.New(testutil.NewDocker())
+	}
+	native := &box.Native{}
+	if name := os.Getenv("RUNBOX_NATIVE_CONFIG"); name != "" {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			log.Fatalf("ReadFile err: %v", err)
+		}
+		if err := json.Unmarshal(data, native); err != nil {
+			log.Fatalf("json.Unmarshal err: %v", err)
+		}
+	}
+	return box.NewNative(native)
+}
+
+// setupLimits reads the caps on request run options from a JSON file, over
+// the defaults.
+func setupLimits(b *box.Box) {
+	name := os.Getenv("RUNBOX_LIMITS_CONFIG")
+	if name == "" {
+		return
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		log.Fatalf("ReadFile err: %v", err)
+	}
+	limits := box.DefaultLimits
+	if err := json.Unmarshal(data, &limits); err != nil {
+		log.Fatalf("json.Unmarshal err: %v", err)
+	}
+	b.SetLimits(limits)
+}
+
+func populateCache(b *box.Box, manifestPath string) {
+	m, err := cache.LoadManifest(manifestPath)
+	if err != nil {
+		log.Fatalf("LoadManifest err: %v", err)
+	}
+	if err := cache.Populate(b, cache.Defaults, m); err != nil {
+		log.Fatalf("Populate err: %v", err)
+	}
+	log.Printf("Populated caches from %s", manifestPath)
+}
+
+func setupRegistry(langRunner *lang.Lang) {
+	name := os.Getenv("RUNBOX_LANGUAGES")
+	if name == "" {
+		return
+	}
+	registry, err := lang.LoadRegistry(name)
+	if err != nil {
+		log.Fatalf("LoadRegistry err: %v", err)
+	}
+	langRunner.SetRegistry(registry)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := registry.Reload(); err != nil {
+				log.Printf("Reload languages err: %v", err)
+				continue
+			}
+			log.Printf("Reloaded languages from %s: %v", name, registry.Names())
+		}
+	}()
+}
+
+func setupRuntimes(b *box.Box, langRunner *lang.Lang) {
+	runtimes, err := b.ProbeRuntimes()
+	if err != nil {
+		log.Printf("ProbeRuntimes err: %v", err)
+	} else {
+		log.Printf("Available runtimes: %v", runtimes)
+	}
+	name := os.Getenv("RUNBOX_RUNTIME_CONFIG")
+	if name == "" {
+		return
+	}
+	c, err := lang.LoadRuntimeConfig(name)
+	if err != nil {
+		log.Fatalf("LoadRuntimeConfig err: %v", err)
+	}
+	if err := langRunner.SetRuntimes(c); err != nil {
+		log.Fatalf("SetRuntimes err: %v", err)
+	}
+}
+
+func readyConfig() handler.ReadyConfig {
+	c := handler.ReadyConfig{DiskPath: os.Getenv("RUNBOX_DISK_PATH")}
+	if langs := os.Getenv("RUNBOX_REQUIRED_LANGS"); langs != "" {
+		c.RequiredLangs = strings.Split(langs, ",")
+	}
+	if v := os.Getenv("RUNBOX_MIN_FREE_BYTES"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			log.Fatalf("RUNBOX_MIN_FREE_BYTES err: %v", err)
+		}
+		c.MinFreeBytes = n
+	}
+	if v := os.Getenv("RUNBOX_MAX_QUEUED"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("RUNBOX_MAX_QUEUED err: %v", err)
+		}
+		c.MaxQueued = n
+	}
+	return c
+}
@@ -0,0 +1,207 @@
+package ansi
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+type Style struct {
+	FG        string `json:"fg,omitempty"`
+	BG        string `json:"bg,omitempty"`
+	Bold      bool   `json:"bold,omitempty"`
+	Italic    bool   `json:"italic,omitempty"`
+	Underline bool   `json:"underline,omitempty"`
+}
+
+type Span struct {
+	Text string `json:"text"`
+	Style
+}
+
+var basic = []string{
+	"#000000", "#cd3131", "#0dbc79", "#e5e510", "#2472c8", "#bc3fbc", "#11a8cd", "#e5e5e5",
+	"#666666", "#f14c4c", "#23d18b", "#f5f543", "#3b8eea", "#d670d6", "#29b8db", "#ffffff",
+}
+
+func color256(n int) string {
+	switch {
+	case n < 16:
+		return basic[n]
+	case n < 232:
+		n -= 16
+		level := func(v int) int {
+			if v == 0 {
+				return 0
+			}
+			return 55 + v*40
+		}
+		return fmt.Sprintf("#%02x%02x%02x", level(n/36), level(n/6%6), level(n%6))
+	default:
+		v := 8 + (n-232)*10
+		return fmt.Sprintf("#%02x%02x%02x", v, v, v)
+	}
+}
+
+// Parse splits a line into styled spans. SGR sequences set the style; every
+// other escape sequence (cursor movement, OSC titles, ...) is dropped.
+func Parse(s string) []Span {
+	var spans []Span
+	var style Style
+	var text strings.Builder
+	flush := func() {
+		if text.Len() == 0 {
+			return
+		}
+		if n := len(spans); n > 0 && spans[n-1].Style == style {
+			spans[n-1].Text += text.String()
+		} else {
+			spans = append(spans, Span{Text: text.String(), Style: style})
+		}
+		text.Reset()
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] != 0x1b {
+			text.WriteByte(s[i])
+			continue
+		}
+		if i+1 >= len(s) {
+			break
+		}
+		switch s[i+1] {
+		case '[':
+			j := i + 2
+			for j < len(s) && (s[j] < 0x40 || s[j] > 0x7e) {
+				j++
+			}
+			if j >= len(s) {
+				i = len(s)
+				break
+			}
+			if s[j] == 'm' {
+				flush()
+				style = applySGR(style, s[i+2:j])
+			}
+			i = j
+		case ']':
+			j := i + 2
+			for j < len(s) && s[j] != 0x07 && !(s[j] == 0x1b && j+1 < len(s) && s[j+1] == '\\') {
+				j++
+			}
+			if j < len(s) && s[j] == 0x1b {
+				j++
+			}
+			i = j
+		default:
+			i++
+		}
+	}
+	flush()
+	return spans
+}
+
+func applySGR(style Style, params string) Style {
+	codes := []int{}
+	for _, p := range strings.Split(params, ";") {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			n = 0
+		}
+		codes = append(codes, n)
+	}
+	for i := 0; i < len(codes); i++ {
+		c := codes[i]
+		switch {
+		case c == 0:
+			style = Style{}
+		case c == 1:
+			style.Bold = true
+		case c == 3:
+			style.Italic = true
+		case c == 4:
+			style.Underline = true
+		case c == 22:
+			style.Bold = false
+		case c == 23:
+			style.Italic = false
+		case c == 24:
+			style.Underline = false
+		case c >= 30 && c <= 37:
+			style.FG = basic[c-30]
+		case c >= 90 && c <= 97:
+			style.FG = basic[c-90+8]
+		case c == 39:
+			style.FG = ""
+		case c >= 40 && c <= 47:
+			style.BG = basic[c-40]
+		case c >= 100 && c <= 107:
+			style.BG = basic[c-100+8]
+		case c == 49:
+			style.BG = ""
+		case c == 38 || c == 48:
+			var color string
+			color, i = extendedColor(codes, i)
+			if c == 38 {
+				style.FG = color
+			} else {
+				style.BG = color
+			}
+		}
+	}
+	return style
+}
+
+func extendedColor(codes []int, i int) (string, int) {
+	if i+2 < len(codes) && codes[i+1] == 5 {
+		n := codes[i+2]
+		if n < 0 || n > 255 {
+			return "", i + 2
+		}
+		return color256(n), i + 2
+	}
+	if i+4 < len(codes) && codes[i+1] == 2 {
+		clamp := func(v int) int { return max(0, min(255, v)) }
+		return fmt.Sprintf("#%02x%02x%02x", clamp(codes[i+2]), clamp(codes[i+3]), clamp(codes[i+4])), i + 4
+	}
+	return "", len(codes)
+}
+
+func Strip(s string) string {
+	var sb strings.Builder
+	for _, span := range Parse(s) {
+		sb.WriteString(span.Text)
+	}
+	return sb.String()
+}
+
+// ToHTML renders a line as escaped text and inline-styled spans. Only colors
+// computed by this package ever reach the style attribute.
+func ToHTML(s string) string {
+	var sb strings.Builder
+	for _, span := range Parse(s) {
+		text := html.EscapeString(span.Text)
+		if span.Style == (Style{}) {
+			sb.WriteString(text)
+			continue
+		}
+		var css []string
+		if span.FG != "" {
+			css = append(css, "color:"+span.FG)
+		}
+		if span.BG != "" {
+			css = append(css, "background-color:"+span.BG)
+		}
+		if span.Bold {
+			css = append(css, "font-weight:bold")
+		}
+		if span.Italic {
+			css = append(css, "font-style:italic")
+		}
+		if span.Underline {
+			css = append(css, "text-decoration:underline")
+		}
+		sb.WriteString(`<span style="` + strings.Join(css, ";") + `">` + text + `</span>`)
+	}
+	return sb.String()
+}
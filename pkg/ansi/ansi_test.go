@@ -0,0 +1,57 @@
+package ansi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zetaoss/runbox/pkg/testutil"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		s    string
+		want []Span
+	}{
+		{"", nil},
+		{"plain", []Span{{Text: "plain"}}},
+		{"\x1b[31mred\x1b[0m ok", []Span{
+			{Text: "red", Style: Style{FG: "#cd3131"}},
+			{Text: " ok"},
+		}},
+		{"\x1b[1;4;92mPASS\x1b[22m x", []Span{
+			{Text: "PASS", Style: Style{FG: "#23d18b", Bold: true, Underline: true}},
+			{Text: " x", Style: Style{FG: "#23d18b", Underline: true}},
+		}},
+		{"\x1b[38;5;196ma\x1b[48;2;1;2;3mb", []Span{
+			{Text: "a", Style: Style{FG: "#ff0000"}},
+			{Text: "b", Style: Style{FG: "#ff0000", BG: "#010203"}},
+		}},
+		{"\x1b]0;title\x07\x1b[2Kdone\x1b[", []Span{{Text: "done"}}},
+		{"\x1b[31m\x1b[31ma\x1b[31mb", []Span{{Text: "ab", Style: Style{FG: "#cd3131"}}}},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i), func(t *testing.T) {
+			require.Equal(t, tc.want, Parse(tc.s))
+		})
+	}
+}
+
+func TestToHTML(t *testing.T) {
+	testCases := []struct {
+		s    string
+		want string
+	}{
+		{"a < b", "a &lt; b"},
+		{"\x1b[1;31merror:\x1b[0m <x>", `<span style="color:#cd3131;font-weight:bold">error:</span> &lt;x&gt;`},
+		{"\x1b[3;4;44m\"q\"", `<span style="background-color:#2472c8;font-style:italic;text-decoration:underline">&#34;q&#34;</span>`},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i), func(t *testing.T) {
+			require.Equal(t, tc.want, ToHTML(tc.s))
+		})
+	}
+}
+
+func TestStrip(t *testing.T) {
+	require.Equal(t, "error: x", Strip("\x1b[1;31merror:\x1b[0m x"))
+}
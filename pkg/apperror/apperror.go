@@ -12,6 +12,19 @@ const (
 	ErrNoFiles         Error = "no files"
 	ErrNoSources       Error = "no sources"
 	ErrInvalidLanguage Error = "invalid language"
+	ErrInvalidVersion  Error = "invalid version"
+	ErrUploadTooLarge  Error = "upload too large"
+	ErrInvalidRender   Error = "invalid render"
+	ErrInvalidCases    Error = "invalid cases"
+	ErrInvalidArgs     Error = "invalid args"
+	ErrInvalidManifest Error = "invalid manifest"
+	ErrInvalidPath     Error = "invalid path"
+	ErrInvalidEntry    Error = "invalid entry"
+	ErrUnsupported     Error = "unsupported"
+	ErrInvalidDataset  Error = "invalid dataset"
+	ErrInvalidURL      Error = "invalid url"
+	ErrInvalidOptions  Error = "invalid options"
+	ErrInvalidEncoding Error = "invalid encoding"
 )
 
 func IsAppError(err error) bool {
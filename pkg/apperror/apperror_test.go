@@ -27,6 +27,16 @@ func TestIsAppError(t *testing.T) {
 			err:  ErrInvalidLanguage,
 			want: true,
 		},
+		{
+			name: "direct ErrInvalidVersion",
+			err:  ErrInvalidVersion,
+			want: true,
+		},
+		{
+			name: "direct ErrUploadTooLarge",
+			err:  ErrUploadTooLarge,
+			want: true,
+		},
 		{
 			name: "wrapped ErrNoSources",
 			err:  fmt.Errorf("wrapped: %w", ErrNoSources),
@@ -0,0 +1,185 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/zetaoss/runbox/pkg/runner/box"
+	"k8s.io/utils/ptr"
+)
+
+const populateTimeoutSeconds int = 600
+
+type Cache struct {
+	Lang    string
+	Volume  string
+	Target  string
+	Env     []string
+	Image   string
+	Pattern *regexp.Regexp
+	Command func(pkgs []string) string
+}
+
+// Manifest lists the packages allowed into each language cache, keyed by language.
+type Manifest map[string][]string
+
+var Defaults = []Cache{
+	{
+		Lang:    "go",
+		Volume:  "runbox-cache-go",
+		Target:  "/cache/go",
+		Env:     []string{"GOPROXY=file:///cache/go/cache/download", "GOSUMDB=off", "GOFLAGS=-mod=mod"},
+		Image:   "ghcr.io/zetaoss/runcontainers/go",
+		Pattern: regexp.MustCompile(`^[A-Za-z0-9._~/-]+@[A-Za-z0-9._+-]+$`),
+		Command: func(pkgs []string) string {
+			return "export GOMODCACHE=/cache/go GOFLAGS=-modcacherw && mkdir -p /tmp/populate && cd /tmp/populate && go mod init populate && go get " + strings.Join(pkgs, " ")
+		},
+	},
+	{
+		Lang:    "java",
+		Volume:  "runbox-cache-java",
+		Target:  "/cache/java",
+		Image:   "maven:3-eclipse-temurin-17",
+		Pattern: regexp.MustCompile(`^[A-Za-z0-9._-]+:[A-Za-z0-9._-]+:[A-Za-z0-9._-]+$`),
+		Command: func(pkgs []string) string {
+			cmds := []string{}
+			for _, p := range pkgs {
+				cmds = append(cmds, "mvn -q -Dmaven.repo.local=/cache/java/repository dependency:copy -Dartifact="+p+" -DoutputDirectory=/cache/java/lib")
+			}
+			return strings.Join(cmds, " && ")
+		},
+	},
+	{
+		Lang:    "javascript",
+		Volume:  "runbox-cache-javascript",
+		Target:  "/cache/javascript",
+		Env:     []string{"npm_config_cache=/cache/javascript/npm", "npm_config_offline=true"},
+		Image:   "ghcr.io/zetaoss/runcontainers/javascript",
+		Pattern: regexp.MustCompile(`^(@[a-z0-9._-]+/)?[a-z0-9._-]+(@[A-Za-z0-9._^~<>=*-]+)?$`),
+		Command: func(pkgs []string) string {
+			return "npm cache add --cache /cache/javascript/npm " + strings.Join(pkgs, " ")
+		},
+	},
+	{
+		Lang:    "python",
+		Volume:  "runbox-cache-python",
+		Target:  "/cache/python",
+		Env:     []string{"PIP_NO_INDEX=1", "PIP_FIND_LINKS=/cache/python/wheels"},
+		Image:   "ghcr.io/zetaoss/runcontainers/python",
+		Pattern: regexp.MustCompile(`^[A-Za-z0-9._-]+(\[[A-Za-z0-9._,-]+\])?(==[A-Za-z0-9._+!-]+)?$`),
+		Command: func(pkgs []string) string {
+			return "pip download --only-binary=:all: --dest /cache/python/wheels " + strings.Join(pkgs, " ")
+		},
+	},
+	{
+		Lang:    "r",
+		Volume:  "runbox-cache-r",
+		Target:  "/cache/r",
+		Env:     []string{"R_LIBS=/cache/r/library"},
+		Image:   "ghcr.io/zetaoss/runcontainers/r",
+		Pattern: regexp.MustCompile(`^[A-Za-z][A-Za-z0-9.]*$`),
+		Command: func(pkgs []string) string {
+			return `mkdir -p /cache/r/library && Rscript -e 'install.packages(c("` + strings.Join(pkgs, `","`) + `"), lib="/cache/r/library", repos="https://cloud.r-project.org")'`
+		},
+	},
+	{
+		Lang:    "ruby",
+		Volume:  "runbox-cache-ruby",
+		Target:  "/cache/ruby",
+		Image:   "ghcr.io/zetaoss/runcontainers/ruby",
+		Pattern: regexp.MustCompile(`^[A-Za-z0-9._-]+:[A-Za-z0-9._-]+$`),
+		Command: func(pkgs []string) string {
+			cmds := []string{"mkdir -p /cache/ruby/gems", "cd /cache/ruby/gems"}
+			for _, p := range pkgs {
+				name, version, _ := strings.Cut(p, ":")
+				cmds = append(cmds, "gem fetch "+name+" --version "+version)
+			}
+			return strings.Join(cmds, " && ")
+		},
+	},
+}
+
+func Find(caches []Cache, lang string) (Cache, bool) {
+	for _, c := range caches {
+		if c.Lang == lang {
+			return c, true
+		}
+	}
+	return Cache{}, false
+}
+
+func (c Cache) Mount(readOnly bool) box.Mount {
+	return box.Mount{
+		Volume:   c.Volume,
+		Target:   c.Target,
+		ReadOnly: readOnly,
+	}
+}
+
+func LoadManifest(name string) (Manifest, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal err: %w", err)
+	}
+	return m, nil
+}
+
+func (m Manifest) Validate(caches []Cache) error {
+	for lang, pkgs := range m {
+		c, ok := Find(caches, lang)
+		if !ok {
+			return fmt.Errorf("no cache for language: '%s'", lang)
+		}
+		for _, p := range pkgs {
+			if !c.Pattern.MatchString(p) {
+				return fmt.Errorf("invalid package for %s: '%s'", lang, p)
+			}
+		}
+	}
+	return nil
+}
+
+func Populate(b *box.Box, caches []Cache, m Manifest) error {
+	if err := m.Validate(caches); err != nil {
+		return err
+	}
+	langs := make([]string, 0, len(m))
+	for lang := range m {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	for _, lang := range langs {
+		if len(m[lang]) == 0 {
+			continue
+		}
+		c, _ := Find(caches, lang)
+		result, err := b.Run(&box.Opts{
+			CollectStats: ptr.To(false),
+			Command:      c.Command(m[lang]),
+			Image:        c.Image,
+			Mounts:       []box.Mount{c.Mount(false)},
+			Shell:        "sh",
+			Timeout:      populateTimeoutSeconds * 1000,
+			User:         "root",
+		})
+		if err != nil {
+			return fmt.Errorf("populate %s err: %w", lang, err)
+		}
+		if result.Timedout {
+			return fmt.Errorf("populate %s: timed out", lang)
+		}
+		if result.Code != 0 {
+			_, stderr := result.StreamStrings()
+			return fmt.Errorf("populate %s: exit code %d: %s", lang, result.Code, stderr)
+		}
+	}
+	return nil
+}
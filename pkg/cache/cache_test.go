@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zetaoss/runbox/pkg/runner/box"
+	"github.com/zetaoss/runbox/pkg/testutil"
+)
+
+func TestFind(t *testing.T) {
+	testCases := []struct {
+		lang   string
+		wantOK bool
+		want   box.Mount
+	}{
+		{"go", true, box.Mount{Volume: "runbox-cache-go", Target: "/cache/go", ReadOnly: true}},
+		{"python", true, box.Mount{Volume: "runbox-cache-python", Target: "/cache/python", ReadOnly: true}},
+		{"bash", false, box.Mount{}},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.lang), func(t *testing.T) {
+			c, ok := Find(Defaults, tc.lang)
+			require.Equal(t, tc.wantOK, ok)
+			if ok {
+				require.Equal(t, tc.want, c.Mount(true))
+			}
+		})
+	}
+}
+
+func TestManifest_Validate(t *testing.T) {
+	testCases := []struct {
+		manifest  Manifest
+		wantError string
+	}{
+		{Manifest{"go": {"github.com/google/uuid@v1.6.0"}}, ""},
+		{Manifest{"java": {"com.google.code.gson:gson:2.11.0"}}, ""},
+		{Manifest{"python": {"numpy==2.1.0", "requests[socks]"}}, ""},
+		{Manifest{"r": {"data.table"}}, ""},
+		{Manifest{"javascript": {"lodash@4.17.21", "@types/node"}}, ""},
+		{Manifest{"ruby": {"rake:13.2.1"}}, ""},
+		{Manifest{"ruby": {"rake"}}, "invalid package for ruby: 'rake'"},
+		{Manifest{"bash": {"x"}}, "no cache for language: 'bash'"},
+		{Manifest{"go": {"github.com/google/uuid"}}, "invalid package for go: 'github.com/google/uuid'"},
+		{Manifest{"python": {"numpy; rm -rf /"}}, "invalid package for python: 'numpy; rm -rf /'"},
+		{Manifest{"r": {`x"),system("id`}}, `invalid package for r: 'x"),system("id'`},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.manifest), func(t *testing.T) {
+			err := tc.manifest.Validate(Defaults)
+			if tc.wantError == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tc.wantError)
+			}
+		})
+	}
+}
+
+func TestLoadManifest(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "manifest.json")
+	require.NoError(t, os.WriteFile(name, []byte(`{"python":["numpy"],"r":["ggplot2"]}`), 0644))
+	got, err := LoadManifest(name)
+	require.NoError(t, err)
+	require.Equal(t, Manifest{"python": {"numpy"}, "r": {"ggplot2"}}, got)
+
+	_, err = LoadManifest(filepath.Join(t.TempDir(), "none.json"))
+	require.Error(t, err)
+}
@@ -0,0 +1,319 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zetaoss/runbox/pkg/apperror"
+	"github.com/zetaoss/runbox/pkg/runner/box"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// EnvVolume prefixes the volume of each environment, so that an install
+	// or a run mounts its own and no other.
+	EnvVolume = "runbox-env-"
+	EnvTarget = "/envs"
+
+	installTimeoutSeconds int = 300
+	installDir                = "/tmp/env"
+	// installUser owns what an install writes. A manifest can be code, a
+	// Gemfile is Ruby, so installing it must not run as root.
+	installUser = "1000:1000"
+	// maxEnvs caps the environment volumes kept; the least recently used
+	// over it are removed once idle for envIdle.
+	maxEnvs = 200
+	envIdle = time.Hour
+)
+
+// Installer turns a dependency manifest into an environment directory. It
+// only ever resolves against the language cache volume, never the network.
+type Installer struct {
+	Langs    []string
+	Manifest string
+	Validate func(body string) error
+	// Install runs in a directory holding the manifest and fills dir.
+	Install func(dir string) string
+	Env     func(dir string) []string
+	// Setup is prepended to the run command, e.g. to link node_modules.
+	Setup func(dir string) string
+}
+
+var Installers = []Installer{
+	{
+		Langs:    []string{"python"},
+		Manifest: "requirements.txt",
+		Validate: validateRequirements,
+		Install: func(dir string) string {
+			return "pip install --no-index --find-links /cache/python/wheels --only-binary=:all: --target " + dir + "/site -r requirements.txt"
+		},
+		Env: func(dir string) []string { return []string{"PYTHONPATH=" + dir + "/site"} },
+	},
+	{
+		Langs:    []string{"go"},
+		Manifest: "go.mod",
+		Install: func(dir string) string {
+			return "GOMODCACHE=" + dir + "/mod go mod download"
+		},
+		Env: func(dir string) []string {
+			return []string{"GOMODCACHE=" + dir + "/mod"}
+		},
+	},
+	{
+		Langs:    []string{"javascript", "typescript"},
+		Manifest: "package.json",
+		Validate: func(body string) error {
+			if !json.Valid([]byte(body)) {
+				return fmt.Errorf("%w: package.json is not valid JSON", apperror.ErrInvalidManifest)
+			}
+			return nil
+		},
+		Install: func(dir string) string {
+			return "cp package.json " + dir + "/ && npm install --offline --ignore-scripts --no-audit --no-fund --prefix " + dir
+		},
+		Setup: func(dir string) string { return "ln -sfn " + dir + "/node_modules node_modules; " },
+	},
+	{
+		Langs:    []string{"r"},
+		Manifest: "DESCRIPTION",
+		// R packages live installed in the cache library; only check that
+		// every dependency is there.
+		Install: func(dir string) string {
+			return `Rscript -e 'd <- read.dcf("DESCRIPTION", fields = c("Depends", "Imports", "LinkingTo")); ` +
+				`p <- trimws(sub("\\(.*", "", unlist(strsplit(d[!is.na(d)], ",")))); ` +
+				`m <- setdiff(p[p != "" & p != "R"], rownames(installed.packages())); ` +
+				`if (length(m) > 0) stop("not in cache: ", paste(m, collapse = ", "))'`
+		},
+	},
+	{
+		Langs:    []string{"ruby"},
+		Manifest: "Gemfile",
+		Install: func(dir string) string {
+			return "cp Gemfile " + dir + "/ && mkdir -p " + dir + "/vendor && ln -s /cache/ruby/gems " + dir + "/vendor/cache && " +
+				"BUNDLE_GEMFILE=" + dir + "/Gemfile BUNDLE_PATH=" + dir + "/bundle bundle install --local"
+		},
+		Env: func(dir string) []string {
+			return []string{"BUNDLE_GEMFILE=" + dir + "/Gemfile", "BUNDLE_PATH=" + dir + "/bundle", "RUBYOPT=-rbundler/setup"}
+		},
+	},
+}
+
+func FindInstaller(lang, manifest string) (Installer, bool) {
+	for _, inst := range Installers {
+		if path.Base(manifest) != inst.Manifest {
+			continue
+		}
+		for _, l := range inst.Langs {
+			if l == lang {
+				return inst, true
+			}
+		}
+	}
+	return Installer{}, false
+}
+
+// validateRequirements keeps pip from being pointed elsewhere by options or
+// direct URLs inside the file.
+func validateRequirements(body string) error {
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "-") || strings.Contains(line, "://") {
+			return fmt.Errorf("%w: requirements.txt line not allowed: '%s'", apperror.ErrInvalidManifest, line)
+		}
+	}
+	return nil
+}
+
+// EnvKey identifies an installed environment by image and manifest content.
+func EnvKey(image, manifest, body string) string {
+	sum := sha256.Sum256([]byte(image + "\n" + manifest + "\n" + body))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Env is what a run needs on top of the language cache to use an installed
+// environment.
+type Env struct {
+	Dir   string
+	Env   []string
+	Mount box.Mount
+	Setup string
+}
+
+type Envs struct {
+	box    *box.Box
+	caches []Cache
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+	ready map[string]bool
+	used  map[string]time.Time
+}
+
+func NewEnvs(b *box.Box, caches []Cache) *Envs {
+	return &Envs{box: b, caches: caches, locks: map[string]*sync.Mutex{}, ready: map[string]bool{}, used: map[string]time.Time{}}
+}
+
+func (e *Envs) lock(key string) *sync.Mutex {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	l, ok := e.locks[key]
+	if !ok {
+		l = &sync.Mutex{}
+		e.locks[key] = l
+	}
+	return l
+}
+
+func (e *Envs) isReady(key string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.ready[key]
+}
+
+// Prepare installs the manifest unless an environment for it already exists.
+// Installs run the request's manifest as an unprivileged user without a
+// network, and can only write their own environment; runs mount it read-only.
+func (e *Envs) Prepare(lang, image string, manifest box.File) (*Env, error) {
+	inst, ok := FindInstaller(lang, manifest.Name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s not supported for %s", apperror.ErrInvalidManifest, manifest.Name, lang)
+	}
+	if inst.Validate != nil {
+		if err := inst.Validate(manifest.Body); err != nil {
+			return nil, err
+		}
+	}
+	c, hasCache := Find(e.caches, lang)
+	if !hasCache && lang == "typescript" {
+		c, hasCache = Find(e.caches, "javascript")
+	}
+	if !hasCache {
+		return nil, fmt.Errorf("%w: no package cache for %s", apperror.ErrInvalidManifest, lang)
+	}
+	key := EnvKey(image, inst.Manifest, manifest.Body)
+	dir := EnvTarget + "/" + key
+	e.mu.Lock()
+	e.used[key] = time.Now()
+	e.mu.Unlock()
+	if err := e.install(key, dir, inst, c, image, manifest.Body); err != nil {
+		return nil, err
+	}
+	env := &Env{Dir: dir, Mount: box.Mount{Volume: EnvVolume + key, Target: dir, ReadOnly: true}}
+	if inst.Env != nil {
+		env.Env = inst.Env(dir)
+	}
+	if inst.Setup != nil {
+		env.Setup = inst.Setup(dir)
+	}
+	return env, nil
+}
+
+func (e *Envs) install(key, dir string, inst Installer, c Cache, image, body string) error {
+	if e.isReady(key) {
+		return nil
+	}
+	l := e.lock(key)
+	l.Lock()
+	defer l.Unlock()
+	if e.isReady(key) {
+		return nil
+	}
+	result, err := e.box.Run(installOpts(key, dir, inst, c, image, body))
+	if err != nil {
+		return fmt.Errorf("install err: %w", err)
+	}
+	if result.Code != 0 || result.Timedout || len(result.Steps) == 0 {
+		return fmt.Errorf("install err: prepare exited with %d", result.Code)
+	}
+	if step := result.Steps[0]; step.Timedout {
+		return fmt.Errorf("%w: install timed out", apperror.ErrInvalidManifest)
+	} else if step.Code != 0 {
+		return fmt.Errorf("%w: install failed: %s", apperror.ErrInvalidManifest, lastLines(step.Stderr, 10))
+	}
+	e.mu.Lock()
+	e.ready[key] = true
+	e.mu.Unlock()
+	e.prune()
+	return nil
+}
+
+// prune removes the environment volumes over maxEnvs, least recently used
+// first. Volumes from before a restart count as the least recently used, and
+// those still mounted by a run are kept.
+func (e *Envs) prune() {
+	volumes, err := e.box.Volumes(EnvVolume)
+	if err != nil {
+		log.Printf("Failed to list volumes: %v", err)
+		return
+	}
+	e.mu.Lock()
+	stale := staleEnvs(volumes, e.used, maxEnvs, time.Now().Add(-envIdle))
+	e.mu.Unlock()
+	for _, key := range stale {
+		l := e.lock(key)
+		l.Lock()
+		if err := e.box.RemoveVolume(EnvVolume + key); err != nil {
+			log.Printf("Failed to remove volume %s: %v", EnvVolume+key, err)
+		} else {
+			e.mu.Lock()
+			delete(e.ready, key)
+			delete(e.used, key)
+			e.mu.Unlock()
+		}
+		l.Unlock()
+	}
+}
+
+// staleEnvs returns the keys of the least recently used volumes over limit
+// that were last used before idleSince.
+func staleEnvs(volumes []string, used map[string]time.Time, limit int, idleSince time.Time) []string {
+	keys := make([]string, len(volumes))
+	for i, v := range volumes {
+		keys[i] = strings.TrimPrefix(v, EnvVolume)
+	}
+	sort.SliceStable(keys, func(i, j int) bool { return used[keys[i]].Before(used[keys[j]]) })
+	stale := []string{}
+	for _, key := range keys[:max(0, len(keys)-limit)] {
+		if used[key].Before(idleSince) {
+			stale = append(stale, key)
+		}
+	}
+	return stale
+}
+
+// installOpts prepares the environment's volume as root, running nothing
+// from the request, then installs into it as installUser in a step.
+func installOpts(key, dir string, inst Installer, c Cache, image, body string) *box.Opts {
+	prepare := fmt.Sprintf("[ -f %[1]s/.done ] || { find %[1]s -mindepth 1 -delete && chown -R %[2]s %[1]s %[3]s; }", dir, installUser, installDir)
+	install := fmt.Sprintf("[ -f %[1]s/.done ] && exit 0; (%[2]s) && touch %[1]s/.done", dir, inst.Install(dir))
+	return &box.Opts{
+		CollectStats:    ptr.To(false),
+		Command:         prepare,
+		Env:             append([]string{"HOME=" + installDir}, c.Env...),
+		Files:           []box.File{{Name: installDir + "/" + inst.Manifest, Body: body}},
+		Image:           image,
+		Mounts:          []box.Mount{c.Mount(true), {Volume: EnvVolume + key, Target: dir}},
+		NetworkDisabled: true,
+		Shell:           "sh",
+		Steps:           []box.Step{{Args: []string{"sh", "-c", install}, User: installUser}},
+		Timeout:         installTimeoutSeconds * 1000,
+		User:            "root",
+		WorkingDir:      installDir,
+	}
+}
+
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zetaoss/runbox/pkg/runner/box"
+	"github.com/zetaoss/runbox/pkg/testutil"
+)
+
+func TestFindInstaller(t *testing.T) {
+	testCases := []struct {
+		lang     string
+		manifest string
+		wantOK   bool
+	}{
+		{"python", "requirements.txt", true},
+		{"go", "go.mod", true},
+		{"typescript", "package.json", true},
+		{"r", "DESCRIPTION", true},
+		{"ruby", "Gemfile", true},
+		{"python", "sub/requirements.txt", true},
+		{"python", "package.json", false},
+		{"bash", "requirements.txt", false},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.lang, tc.manifest), func(t *testing.T) {
+			_, ok := FindInstaller(tc.lang, tc.manifest)
+			require.Equal(t, tc.wantOK, ok)
+		})
+	}
+}
+
+func TestPrepare_invalid(t *testing.T) {
+	e := NewEnvs(nil, Defaults)
+	testCases := []struct {
+		lang      string
+		manifest  box.File
+		wantError string
+	}{
+		{"bash", box.File{Name: "requirements.txt"}, "invalid manifest: requirements.txt not supported for bash"},
+		{"python", box.File{Name: "requirements.txt", Body: "numpy\n--index-url https://example.com"}, "invalid manifest: requirements.txt line not allowed: '--index-url https://example.com'"},
+		{"python", box.File{Name: "requirements.txt", Body: "x @ https://example.com/x.whl"}, "invalid manifest: requirements.txt line not allowed: 'x @ https://example.com/x.whl'"},
+		{"javascript", box.File{Name: "package.json", Body: "{"}, "invalid manifest: package.json is not valid JSON"},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.lang, tc.manifest.Name), func(t *testing.T) {
+			_, err := e.Prepare(tc.lang, "img", tc.manifest)
+			require.EqualError(t, err, tc.wantError)
+		})
+	}
+}
+
+func TestEnvKey(t *testing.T) {
+	a := EnvKey("python:3.12", "requirements.txt", "numpy")
+	require.Len(t, a, 32)
+	require.Equal(t, a, EnvKey("python:3.12", "requirements.txt", "numpy"))
+	require.NotEqual(t, a, EnvKey("python:3.13", "requirements.txt", "numpy"))
+	require.NotEqual(t, a, EnvKey("python:3.12", "requirements.txt", "pandas"))
+}
+
+func TestStaleEnvs(t *testing.T) {
+	now := time.Now()
+	volumes := []string{EnvVolume + "a", EnvVolume + "b", EnvVolume + "c", EnvVolume + "d"}
+	used := map[string]time.Time{"a": now.Add(-3 * time.Hour), "b": now, "c": now.Add(-2 * time.Hour)}
+	testCases := []struct {
+		limit int
+		want  []string
+	}{
+		{4, []string{}},
+		{3, []string{"d"}},
+		{1, []string{"d", "a", "c"}},
+		{0, []string{"d", "a", "c"}},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.limit), func(t *testing.T) {
+			require.Equal(t, tc.want, staleEnvs(volumes, used, tc.limit, now.Add(-time.Hour)))
+		})
+	}
+}
+
+func TestInstallOpts(t *testing.T) {
+	inst, _ := FindInstaller("ruby", "Gemfile")
+	c, _ := Find(Defaults, "ruby")
+	key := EnvKey("ruby", "Gemfile", "gem 'x'")
+	opts := installOpts(key, EnvTarget+"/"+key, inst, c, "ruby", "gem 'x'")
+	require.Equal(t, "root", opts.User)
+	require.NotContains(t, opts.Command, "bundle")
+	require.True(t, opts.NetworkDisabled)
+	require.Equal(t, []box.Mount{c.Mount(true), {Volume: EnvVolume + key, Target: EnvTarget + "/" + key}}, opts.Mounts)
+	require.Len(t, opts.Steps, 1)
+	require.Equal(t, installUser, opts.Steps[0].User)
+	require.Contains(t, opts.Steps[0].Args[2], "bundle install --local")
+}
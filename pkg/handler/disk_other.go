@@ -0,0 +1,11 @@
+//go:build !unix
+
+package handler
+
+import (
+	"errors"
+)
+
+func diskFree(path string) (uint64, error) {
+	return 0, errors.New("disk check not supported")
+}
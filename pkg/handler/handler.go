@@ -2,8 +2,11 @@ package handler
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/zetaoss/runbox/pkg/apperror"
+	"github.com/zetaoss/runbox/pkg/runner/box"
 	"github.com/zetaoss/runbox/pkg/runner/lang"
 	"github.com/zetaoss/runbox/pkg/runner/notebook"
 )
@@ -12,12 +15,15 @@ type Handler struct {
 	langRunner     *lang.Lang
 	notebookRunner *notebook.Notebook
 	router         *gin.Engine
+	readyConfig    ReadyConfig
+	maxBodyBytes   int64
 }
 
 func New(langRunner *lang.Lang, notebookRunner *notebook.Notebook) *Handler {
 	h := &Handler{
 		langRunner:     langRunner,
 		notebookRunner: notebookRunner,
+		maxBodyBytes:   box.DefaultMaxUploadBytes,
 	}
 	h.setupRouter()
 	return h
@@ -26,7 +32,10 @@ func New(langRunner *lang.Lang, notebookRunner *notebook.Notebook) *Handler {
 func (h *Handler) setupRouter() {
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.Default()
+	r.Use(h.limitBody)
 	r.GET("/-/healthy", healthy)
+	r.GET("/-/ready", h.ready)
+	r.POST("/judge", h.judge)
 	r.POST("/lang", h.lang)
 	r.POST("/notebook", h.notebook)
 	h.router = r
@@ -36,6 +45,31 @@ func (h *Handler) Run(addr ...string) error {
 	return h.router.Run(addr...)
 }
 
+// SetMaxBodyBytes caps the size of request bodies.
+func (h *Handler) SetMaxBodyBytes(n int64) {
+	h.maxBodyBytes = n
+}
+
+// limitBody rejects a body over maxBodyBytes before it is decoded, by its
+// length when sent and by cutting it off when not.
+func (h *Handler) limitBody(c *gin.Context) {
+	if c.Request.ContentLength > h.maxBodyBytes {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": apperror.ErrUploadTooLarge.Error()})
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxBodyBytes)
+	c.Next()
+}
+
+// tenant is the tenant of the API key sent as a bearer token.
+func (h *Handler) tenant(c *gin.Context) string {
+	key, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return h.langRunner.Tenant(key)
+}
+
 func healthy(c *gin.Context) {
 	c.String(http.StatusOK, "Healthy.\n")
 }
@@ -1,6 +1,10 @@
 package handler
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -27,3 +31,94 @@ func TestHealthy(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 	assert.Equal(t, "Healthy.\n", w.Body.String())
 }
+
+func TestReady(t *testing.T) {
+	// Without a daemon the checks fail for that reason alone.
+	if err := handler1.langRunner.Box().Ping(); err != nil {
+		t.Skipf("docker unavailable: %v", err)
+	}
+	testCases := []struct {
+		config    ReadyConfig
+		wantReady bool
+	}{
+		{ReadyConfig{MinFreeBytes: math.MaxUint64}, false},
+		{ReadyConfig{RequiredLangs: []string{"nonexistent"}}, false},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.config), func(t *testing.T) {
+			handler1.SetReadyConfig(tc.config)
+			defer handler1.SetReadyConfig(ReadyConfig{})
+			req := httptest.NewRequest("GET", "/-/ready", nil)
+			w := httptest.NewRecorder()
+			handler1.router.ServeHTTP(w, req)
+
+			var got Readiness
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+			assert.Equal(t, tc.wantReady, got.Ready)
+			assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+			assert.False(t, got.Runs.CircuitOpen)
+		})
+	}
+}
+
+type fakeBox struct {
+	pingErr     error
+	images      map[string]bool
+	queued      int
+	circuitOpen bool
+}
+
+func (b *fakeBox) Ping() error                         { return b.pingErr }
+func (b *fakeBox) HasImage(image string) (bool, error) { return b.images[image], nil }
+func (b *fakeBox) InFlight() int                       { return 2 }
+func (b *fakeBox) MaxRuns() int                        { return 2 }
+func (b *fakeBox) Queued() int                         { return b.queued }
+func (b *fakeBox) CircuitOpen() bool                   { return b.circuitOpen }
+
+func TestReadiness(t *testing.T) {
+	image := func(lang string) string { return "img/" + lang }
+	disk := t.TempDir()
+	testCases := []struct {
+		box       *fakeBox
+		config    ReadyConfig
+		wantReady bool
+		wantRuns  RunsCheck
+	}{
+		{&fakeBox{}, ReadyConfig{}, true, RunsCheck{Check: Check{OK: true}, InFlight: 2, MaxRuns: 2}},
+		{&fakeBox{pingErr: errors.New("down")}, ReadyConfig{}, false, RunsCheck{Check: Check{OK: true}, InFlight: 2, MaxRuns: 2}},
+		{&fakeBox{pingErr: errors.New("down")}, ReadyConfig{RequiredLangs: []string{"go"}}, false, RunsCheck{Check: Check{OK: true}, InFlight: 2, MaxRuns: 2}},
+		{&fakeBox{images: map[string]bool{"img/go": true}}, ReadyConfig{RequiredLangs: []string{"go"}}, true, RunsCheck{Check: Check{OK: true}, InFlight: 2, MaxRuns: 2}},
+		{&fakeBox{}, ReadyConfig{RequiredLangs: []string{"go"}}, false, RunsCheck{Check: Check{OK: true}, InFlight: 2, MaxRuns: 2}},
+		{&fakeBox{}, ReadyConfig{MinFreeBytes: math.MaxUint64}, false, RunsCheck{Check: Check{OK: true}, InFlight: 2, MaxRuns: 2}},
+		{&fakeBox{circuitOpen: true}, ReadyConfig{}, false, RunsCheck{InFlight: 2, MaxRuns: 2, CircuitOpen: true}},
+		{&fakeBox{queued: 3}, ReadyConfig{MaxQueued: 3}, true, RunsCheck{Check: Check{OK: true}, InFlight: 2, MaxRuns: 2, Queued: 3}},
+		{&fakeBox{queued: 4}, ReadyConfig{MaxQueued: 3}, false, RunsCheck{Check: Check{Error: "queue full"}, InFlight: 2, MaxRuns: 2, Queued: 4}},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.config), func(t *testing.T) {
+			tc.config.DiskPath = disk
+			got := readiness(tc.box, image, tc.config)
+			assert.Equal(t, tc.wantReady, got.Ready)
+			assert.Equal(t, tc.wantRuns, got.Runs)
+		})
+	}
+}
+
+func TestLimitBody(t *testing.T) {
+	handler1.SetMaxBodyBytes(16)
+	defer handler1.SetMaxBodyBytes(box.DefaultMaxUploadBytes)
+	body := `{"lang":"bash","files":[{"body":"echo hello"}]}`
+
+	req := httptest.NewRequest("POST", "/lang", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	handler1.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, `{"error":"upload too large"}`, w.Body.String())
+
+	req = httptest.NewRequest("POST", "/judge", bytes.NewBufferString(body))
+	req.ContentLength = -1 // chunked
+	w = httptest.NewRecorder()
+	handler1.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, `{"error":"http: request body too large"}`, w.Body.String())
+}
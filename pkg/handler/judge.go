@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zetaoss/runbox/pkg/apperror"
+	"github.com/zetaoss/runbox/pkg/runner/box"
+	"github.com/zetaoss/runbox/pkg/runner/lang"
+)
+
+func (h *Handler) judge(c *gin.Context) {
+	var input lang.JudgeInput
+	if err := c.BindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.Submission.Tenant = h.tenant(c)
+	result, err := h.langRunner.Judge(input)
+	if err != nil {
+		if errors.Is(err, box.ErrCircuitOpen) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		if apperror.IsAppError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
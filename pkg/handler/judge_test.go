@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zetaoss/runbox/pkg/testutil"
+)
+
+func TestJudge(t *testing.T) {
+	testCases := []struct {
+		data         map[string]any
+		wantCode     int
+		wantResponse string
+	}{
+		{
+			data: map[string]any{
+				"submission": map[string]any{"lang": "bash", "files": []map[string]any{{"body": "cat"}}},
+			},
+			wantCode:     400,
+			wantResponse: `{"error":"invalid cases"}`,
+		},
+		{
+			data: map[string]any{
+				"submission": map[string]any{"lang": "_", "files": []map[string]any{{"body": "cat"}}},
+				"cases":      []map[string]any{{"stdin": "a", "expected": "a"}},
+			},
+			wantCode:     400,
+			wantResponse: `{"error":"invalid language"}`,
+		},
+		{
+			data: map[string]any{
+				"submission": map[string]any{"lang": "bash", "files": []map[string]any{{"body": "cat"}}},
+				"cases":      []map[string]any{{"stdin": "a", "expected": "a", "timeLimit": 600000}},
+			},
+			wantCode:     400,
+			wantResponse: `{"error":"invalid cases"}`,
+		},
+		{
+			data: map[string]any{
+				"submission": map[string]any{"lang": "bash", "files": []map[string]any{{"body": "cat"}}},
+				"cases":      []map[string]any{{"stdin": "a", "expected": "a", "memoryLimit": 1024}},
+			},
+			wantCode:     400,
+			wantResponse: `{"error":"invalid cases"}`,
+		},
+		{
+			data: map[string]any{
+				"submission": map[string]any{"lang": "bash", "files": []map[string]any{{"body": "read a b; echo $((a + b))"}}},
+				"cases": []map[string]any{
+					{"stdin": "1 2\n", "expected": "3\n"},
+					{"stdin": "2 2\n", "expected": "5\n"},
+				},
+			},
+			wantCode:     200,
+			wantResponse: `{"verdict":"WA","cases":[{"verdict":"AC","time":0,"stdout":"3\n"},{"verdict":"WA","time":0,"stdout":"4\n","diff":"-5\n+4\n"}]}`,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.data), func(t *testing.T) {
+			requestBody, err := json.Marshal(tc.data)
+			require.NoError(t, err)
+			req := httptest.NewRequest("POST", "/judge", bytes.NewBuffer(requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			handler1.router.ServeHTTP(w, req)
+			require.Equal(t, tc.wantCode, w.Code)
+			response := w.Body.String()
+			response = regexp.MustCompile(`"time":\d+`).ReplaceAllString(response, `"time":0`)
+			require.Equal(t, tc.wantResponse, response)
+		})
+	}
+}
@@ -1,10 +1,12 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/zetaoss/runbox/pkg/ansi"
 	"github.com/zetaoss/runbox/pkg/apperror"
 	"github.com/zetaoss/runbox/pkg/runner/box"
 	"github.com/zetaoss/runbox/pkg/runner/lang"
@@ -18,27 +20,122 @@ type LangResult struct {
 	Time     int      `json:"time,omitempty"`
 	Timedout bool     `json:"timedout,omitempty"`
 	Images   []string `json:"images,omitempty"`
+	Runtime  string   `json:"runtime,omitempty"`
+
+	OutputTruncated bool           `json:"outputTruncated,omitempty"`
+	ImageFormats    []string       `json:"imageFormats,omitempty"`
+	SkippedImages   int            `json:"skippedImages,omitempty"`
+	Artifacts       []box.Artifact `json:"artifacts,omitempty"`
+
+	Version     string          `json:"version,omitempty"`
+	ImageDigest string          `json:"imageDigest,omitempty"`
+	Detected    *lang.Detection `json:"detected,omitempty"`
+
+	StdoutBase64 string `json:"stdoutBase64,omitempty"`
+	StderrBase64 string `json:"stderrBase64,omitempty"`
+
+	LogsHTML  []string    `json:"logsHtml,omitempty"`
+	LogsSpans []StyledLog `json:"logsSpans,omitempty"`
+
+	Phases map[string]int `json:"phases,omitempty"`
+
+	Diagnostics []lang.Diagnostic `json:"diagnostics,omitempty"`
+	SQL         *lang.SQLResult   `json:"sql,omitempty"`
+}
+
+type StyledLog struct {
+	Stream int         `json:"stream"`
+	Spans  []ansi.Span `json:"spans"`
+}
+
+// LangRequest is a lang.Input with the run options next to its fields.
+type LangRequest struct {
+	lang.Input
+	Options box.RunOptions `json:"options"`
 }
 
 func (h *Handler) lang(c *gin.Context) {
-	var input lang.Input
-	if err := c.BindJSON(&input); err != nil {
+	var req LangRequest
+	if err := c.BindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	result, err := h.langRunner.Run(input)
-	if err != nil {
-		switch err {
-		case apperror.ErrInvalidLanguage:
-			c.JSON(http.StatusBadRequest, gin.H{"error": err})
-		case apperror.ErrNoFiles:
+	input := req.Input
+	if input.Render != "" && input.Render != "html" && input.Render != "spans" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": apperror.ErrInvalidRender.Error()})
+		return
+	}
+	switch input.OutputEncoding {
+	case box.EncodingUTF8, box.EncodingLatin1, box.EncodingAuto:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: '%s'", apperror.ErrInvalidEncoding, input.OutputEncoding)})
+		return
+	}
+	var detected *lang.Detection
+	if input.Lang == "" && len(input.Files) > 0 {
+		var err error
+		input, detected, err = h.langRunner.Detect(input)
+		if err != nil {
+			var ambiguous *lang.AmbiguousError
+			if errors.As(err, &ambiguous) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "candidates": ambiguous.Candidates})
+				return
+			}
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	input.Tenant = h.tenant(c)
+	var result *box.Result
+	var sqlResult *lang.SQLResult
+	var err error
+	if input.SQL {
+		result, sqlResult, err = h.langRunner.RunSQL(input, req.Options)
+	} else {
+		result, err = h.langRunner.Run(input, req.Options)
+	}
+	if err != nil {
+		if errors.Is(err, box.ErrCircuitOpen) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, apperror.ErrUploadTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": apperror.ErrUploadTooLarge.Error()})
+			return
+		}
+		body := gin.H{"error": err.Error()}
+		var runErr *box.RunError
+		if input.Phases && errors.As(err, &runErr) {
+			body["phases"] = runErr.Phases
+		}
+		if apperror.IsAppError(err) {
+			c.JSON(http.StatusBadRequest, body)
+		} else {
+			c.JSON(http.StatusInternalServerError, body)
 		}
 		return
 	}
-	c.JSON(http.StatusOK, toLangResult(result))
+	langResult := toLangResult(result)
+	langResult.Version = h.langRunner.Version(input.Lang, input.Version)
+	langResult.Detected = detected
+	langResult.SQL = sqlResult
+	langResult.Diagnostics = h.langRunner.Diagnostics(input, result)
+	render(langResult, result, input.Render)
+	if input.Phases {
+		langResult.Phases = result.Phases
+	}
+	c.JSON(http.StatusOK, langResult)
+}
+
+func render(langResult *LangResult, boxResult *box.Result, mode string) {
+	for _, l := range boxResult.Logs {
+		switch mode {
+		case "html":
+			langResult.LogsHTML = append(langResult.LogsHTML, fmt.Sprintf("%d", l.Stream)+ansi.ToHTML(l.Log))
+		case "spans":
+			langResult.LogsSpans = append(langResult.LogsSpans, StyledLog{Stream: l.Stream, Spans: ansi.Parse(l.Log)})
+		}
+	}
 }
 
 func toLangResult(boxResult *box.Result) *LangResult {
@@ -54,5 +151,16 @@ func toLangResult(boxResult *box.Result) *LangResult {
 		Time:     boxResult.Time,
 		Timedout: boxResult.Timedout,
 		Images:   boxResult.Images,
+		Runtime:  boxResult.Runtime,
+
+		OutputTruncated: boxResult.OutputTruncated,
+		ImageFormats:    boxResult.ImageFormats,
+		SkippedImages:   boxResult.SkippedImages,
+		Artifacts:       boxResult.Artifacts,
+
+		ImageDigest: boxResult.ImageDigest,
+
+		StdoutBase64: boxResult.StdoutBase64,
+		StderrBase64: boxResult.StderrBase64,
 	}
 }
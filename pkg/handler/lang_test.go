@@ -8,6 +8,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"github.com/zetaoss/runbox/pkg/ansi"
+	"github.com/zetaoss/runbox/pkg/runner/box"
 	"github.com/zetaoss/runbox/pkg/testutil"
 )
 
@@ -29,6 +31,20 @@ func TestLang(t *testing.T) {
 			wantCode:     400,
 			wantResponse: `{"error":"invalid language"}`,
 		},
+		{
+			data: map[string]any{
+				"files": []map[string]any{{"body": "int main() { return 0; }"}},
+			},
+			wantCode:     400,
+			wantResponse: `{"candidates":["c","cpp"],"error":"invalid language: ambiguous, candidates: c, cpp"}`,
+		},
+		{
+			data: map[string]any{
+				"files": []map[string]any{{"body": "hello world"}},
+			},
+			wantCode:     400,
+			wantResponse: `{"error":"invalid language: cannot detect"}`,
+		},
 		{
 			data: map[string]any{
 				"lang":  "bash",
@@ -37,6 +53,33 @@ func TestLang(t *testing.T) {
 			wantCode:     400,
 			wantResponse: `{"error":"no files"}`,
 		},
+		{
+			data: map[string]any{
+				"lang":    "bash",
+				"files":   []map[string]any{{"body": "echo hello"}},
+				"options": map[string]any{"timeoutSeconds": 3600},
+			},
+			wantCode:     400,
+			wantResponse: `{"error":"invalid options: timeoutSeconds must be 0 to 120"}`,
+		},
+		{
+			data: map[string]any{
+				"lang":   "bash",
+				"files":  []map[string]any{{"body": "echo hello"}},
+				"render": "svg",
+			},
+			wantCode:     400,
+			wantResponse: `{"error":"invalid render"}`,
+		},
+		{
+			data: map[string]any{
+				"lang":           "bash",
+				"files":          []map[string]any{{"body": "echo hello"}},
+				"outputEncoding": "utf-8",
+			},
+			wantCode:     400,
+			wantResponse: `{"error":"invalid encoding: 'utf-8'"}`,
+		},
 		{
 			data: map[string]any{
 				"lang": "bash",
@@ -124,3 +167,26 @@ func TestLang(t *testing.T) {
 		})
 	}
 }
+
+func TestRender(t *testing.T) {
+	boxResult := &box.Result{Logs: []box.Log{
+		{Stream: 1, Log: "\x1b[32mok\x1b[0m <b>"},
+		{Stream: 2, Log: "plain"},
+	}}
+
+	langResult := &LangResult{}
+	render(langResult, boxResult, "html")
+	require.Equal(t, []string{`1<span style="color:#0dbc79">ok</span> &lt;b&gt;`, "2plain"}, langResult.LogsHTML)
+	require.Nil(t, langResult.LogsSpans)
+
+	langResult = &LangResult{}
+	render(langResult, boxResult, "spans")
+	require.Equal(t, []StyledLog{
+		{Stream: 1, Spans: []ansi.Span{{Text: "ok", Style: ansi.Style{FG: "#0dbc79"}}, {Text: " <b>"}}},
+		{Stream: 2, Spans: []ansi.Span{{Text: "plain"}}},
+	}, langResult.LogsSpans)
+
+	langResult = &LangResult{}
+	render(langResult, boxResult, "")
+	require.Equal(t, &LangResult{}, langResult)
+}
@@ -1,23 +1,35 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/zetaoss/runbox/pkg/apperror"
+	"github.com/zetaoss/runbox/pkg/runner/box"
 	"github.com/zetaoss/runbox/pkg/runner/notebook"
 )
 
+// NotebookRequest is a notebook.Input with the run options next to its fields.
+type NotebookRequest struct {
+	notebook.Input
+	Options box.RunOptions `json:"options"`
+}
+
 func (h *Handler) notebook(c *gin.Context) {
-	var input notebook.Input
-	if err := c.BindJSON(&input); err != nil {
+	var req NotebookRequest
+	if err := c.BindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	result, err := h.notebookRunner.Run(input)
+	result, err := h.notebookRunner.Run(req.Input, req.Options)
 	if err != nil {
+		if errors.Is(err, box.ErrCircuitOpen) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
 		if apperror.IsAppError(err) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err})
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		}
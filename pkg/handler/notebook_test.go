@@ -33,6 +33,24 @@ func TestNotebook(t *testing.T) {
 			wantCode:     400,
 			wantResponse: `{"error":"no sources"}`,
 		},
+		{
+			data: map[string]any{
+				"lang":    "python",
+				"sources": []string{`print(1)`},
+				"options": map[string]any{"timeoutSeconds": 3600},
+			},
+			wantCode:     400,
+			wantResponse: `{"error":"invalid options: timeoutSeconds must be 0 to 120"}`,
+		},
+		{
+			data: map[string]any{
+				"lang":    "python",
+				"sources": []string{`print(1)`},
+				"options": map[string]any{"priority": "urgent"},
+			},
+			wantCode:     400,
+			wantResponse: `{"error":"invalid options: unknown priority 'urgent'"}`,
+		},
 		{
 			data: map[string]any{
 				"lang": "python",
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReadyConfig struct {
+	RequiredLangs []string
+	DiskPath      string
+	MinFreeBytes  uint64
+	// MaxQueued is the most runs waiting for a slot before the node is not
+	// ready. 0 is no limit.
+	MaxQueued int
+}
+
+type Check struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type DiskCheck struct {
+	Check
+	FreeBytes uint64 `json:"freeBytes"`
+}
+
+type ImagesCheck struct {
+	Check
+	Langs map[string]bool `json:"langs"`
+}
+
+type RunsCheck struct {
+	Check
+	InFlight    int  `json:"inFlight"`
+	MaxRuns     int  `json:"maxRuns"`
+	Queued      int  `json:"queued"`
+	CircuitOpen bool `json:"circuitOpen"`
+}
+
+// readyBox is the part of a box the readiness checks look at.
+type readyBox interface {
+	Ping() error
+	HasImage(image string) (bool, error)
+	InFlight() int
+	MaxRuns() int
+	Queued() int
+	CircuitOpen() bool
+}
+
+type Readiness struct {
+	Ready  bool        `json:"ready"`
+	Daemon Check       `json:"daemon"`
+	Disk   DiskCheck   `json:"disk"`
+	Images ImagesCheck `json:"images"`
+	Runs   RunsCheck   `json:"runs"`
+}
+
+func (h *Handler) SetReadyConfig(c ReadyConfig) {
+	h.readyConfig = c
+}
+
+func (h *Handler) ready(c *gin.Context) {
+	r := h.readiness()
+	code := http.StatusOK
+	if !r.Ready {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, r)
+}
+
+func (h *Handler) readiness() *Readiness {
+	return readiness(h.langRunner.Box(), h.langRunner.Image, h.readyConfig)
+}
+
+func readiness(b readyBox, image func(lang string) string, config ReadyConfig) *Readiness {
+	r := &Readiness{}
+
+	r.Daemon.OK = true
+	if err := b.Ping(); err != nil {
+		r.Daemon = Check{Error: err.Error()}
+	}
+
+	diskPath := config.DiskPath
+	if diskPath == "" {
+		diskPath = os.TempDir()
+	}
+	free, err := diskFree(diskPath)
+	r.Disk.FreeBytes = free
+	r.Disk.OK = err == nil && free >= config.MinFreeBytes
+	if err != nil {
+		r.Disk.Error = err.Error()
+	}
+
+	r.Images.OK = true
+	r.Images.Langs = map[string]bool{}
+	if r.Daemon.OK {
+		for _, l := range config.RequiredLangs {
+			ok, err := b.HasImage(image(l))
+			r.Images.Langs[l] = ok
+			if err != nil {
+				r.Images.Error = err.Error()
+			}
+			r.Images.OK = r.Images.OK && ok
+		}
+	} else if len(config.RequiredLangs) > 0 {
+		r.Images.OK = false
+		r.Images.Error = "daemon unavailable"
+	}
+
+	r.Runs.InFlight = b.InFlight()
+	r.Runs.MaxRuns = b.MaxRuns()
+	r.Runs.Queued = b.Queued()
+	r.Runs.CircuitOpen = b.CircuitOpen()
+	r.Runs.OK = !r.Runs.CircuitOpen
+	if config.MaxQueued > 0 && r.Runs.Queued > config.MaxQueued {
+		r.Runs.OK = false
+		r.Runs.Error = "queue full"
+	}
+
+	r.Ready = r.Daemon.OK && r.Disk.OK && r.Images.OK && r.Runs.OK
+	return r
+}
@@ -1,22 +1,192 @@
 package box
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
 )
 
 type Box struct {
-	cli *client.Client
+	cli            *client.Client
+	native         *Native
+	breaker        *breaker
+	inflight       atomic.Int64
+	queued         atomic.Int64
+	slots          chan struct{}
+	runtimes       map[string]bool
+	defaultRuntime string
+	limits         Limits
 }
 
 func New(cli *client.Client) *Box {
-	return &Box{cli}
+	return &Box{cli: cli, breaker: newBreaker(), limits: DefaultLimits}
+}
+
+// Limits caps the RunOptions requests may set on runs in this box.
+func (b *Box) Limits() Limits {
+	return b.limits
+}
+
+func (b *Box) SetLimits(limits Limits) {
+	b.limits = limits
+}
+
+func (b *Box) ProbeRuntimes() ([]string, error) {
+	if b.native != nil {
+		return nil, errors.New("native backend has no runtimes")
+	}
+	info, err := b.cli.Info(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	b.runtimes = map[string]bool{}
+	names := []string{}
+	for name := range info.Runtimes {
+		b.runtimes[name] = true
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	b.defaultRuntime = info.DefaultRuntime
+	return names, nil
+}
+
+// HasRuntime reports whether the daemon has the runtime. Only the default one
+// is known to exist before ProbeRuntimes succeeds.
+func (b *Box) HasRuntime(name string) bool {
+	return name == "" || b.runtimes[name]
+}
+
+func (b *Box) Ping() error {
+	if b.native != nil {
+		return nil
+	}
+	_, err := b.cli.Ping(context.Background())
+	return err
+}
+
+func (b *Box) HasImage(image string) (bool, error) {
+	if b.native != nil {
+		root, err := b.native.rootFor(image)
+		if err != nil {
+			return false, nil
+		}
+		_, err = os.Stat(root)
+		return err == nil, nil
+	}
+	_, ok, err := NewSession(b.cli, &Opts{Image: image}).findImage()
+	return ok, err
+}
+
+// Volumes lists the names of the volumes that start with prefix.
+func (b *Box) Volumes(prefix string) ([]string, error) {
+	if b.native != nil {
+		return nil, errors.New("native backend has no volumes")
+	}
+	resp, err := b.cli.VolumeList(context.Background(), volume.ListOptions{Filters: filters.NewArgs(filters.Arg("name", prefix))})
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, v := range resp.Volumes {
+		if strings.HasPrefix(v.Name, prefix) {
+			names = append(names, v.Name)
+		}
+	}
+	return names, nil
+}
+
+// RemoveVolume removes a volume, unless a container still uses it.
+func (b *Box) RemoveVolume(name string) error {
+	if b.native != nil {
+		return errors.New("native backend has no volumes")
+	}
+	return b.cli.VolumeRemove(context.Background(), name, false)
+}
+
+func (b *Box) CircuitOpen() bool {
+	if b.breaker == nil {
+		return false
+	}
+	return !b.breaker.closed()
+}
+
+func (b *Box) InFlight() int {
+	return int(b.inflight.Load())
+}
+
+// Queued is the number of runs waiting for one of MaxRuns to finish.
+func (b *Box) Queued() int {
+	return int(b.queued.Load())
+}
+
+// SetMaxRuns caps the runs in flight at n, queueing the rest. 0 is no cap.
+func (b *Box) SetMaxRuns(n int) {
+	b.slots = nil
+	if n > 0 {
+		b.slots = make(chan struct{}, n)
+	}
+}
+
+func (b *Box) MaxRuns() int {
+	return cap(b.slots)
+}
+
+func (b *Box) acquire() func() {
+	if b.slots == nil {
+		return func() {}
+	}
+	b.queued.Add(1)
+	b.slots <- struct{}{}
+	b.queued.Add(-1)
+	return func() { <-b.slots }
 }
 
+// RunError is the error of a run that failed, with the milliseconds its
+// phases took until then.
+type RunError struct {
+	Err    error
+	Phases map[string]int
+}
+
+func (e *RunError) Error() string { return e.Err.Error() }
+
+func (e *RunError) Unwrap() error { return e.Err }
+
+// Run runs opts. A run that fails after it started returns a *RunError.
 func (b *Box) Run(opts *Opts) (*Result, error) {
+	defer b.acquire()()
+	b.inflight.Add(1)
+	defer b.inflight.Add(-1)
+	if !b.HasRuntime(opts.Runtime) {
+		return nil, fmt.Errorf("runtime not available: '%s'", opts.Runtime)
+	}
+	if b.native != nil {
+		return b.native.run(opts)
+	}
+	if !b.breaker.allow() {
+		return nil, ErrCircuitOpen
+	}
 	s := NewSession(b.cli, opts)
-	s.pruneStaleContainers()
-	if err := s.run(); err != nil {
-		return nil, err
+	_ = s.phase(PhasePrune, func() error {
+		s.pruneStaleContainers()
+		return nil
+	})
+	err := s.run()
+	b.breaker.record(err)
+	if err != nil {
+		return nil, &RunError{Err: err, Phases: s.result.Phases}
+	}
+	s.result.Runtime = opts.Runtime
+	if s.result.Runtime == "" {
+		s.result.Runtime = b.defaultRuntime
 	}
 	return &s.result, nil
 }
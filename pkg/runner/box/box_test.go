@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/docker/docker/client"
 	"github.com/google/go-cmp/cmp"
@@ -33,6 +34,12 @@ func equalResult(t *testing.T, want, got *Result) {
 	assert.Less(t, got.Time, want.Time*100, "time")
 	want.Time = got.Time
 
+	assert.NotEmpty(t, got.Phases, "phases")
+	want.Phases = got.Phases
+
+	assert.NotEmpty(t, got.ImageDigest, "imageDigest")
+	want.ImageDigest = got.ImageDigest
+
 	assert.Equal(t, want, got)
 }
 
@@ -52,6 +59,25 @@ func TestDockerEnv(t *testing.T) {
 	assert.NotEmpty(t, cli)
 }
 
+func TestMaxRuns(t *testing.T) {
+	b := New(nil)
+	assert.Equal(t, 0, b.MaxRuns())
+	b.acquire()()
+
+	b.SetMaxRuns(1)
+	assert.Equal(t, 1, b.MaxRuns())
+	release := b.acquire()
+	done := make(chan struct{})
+	go func() {
+		b.acquire()()
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { return b.Queued() == 1 }, time.Second, time.Millisecond)
+	release()
+	<-done
+	assert.Equal(t, 0, b.Queued())
+}
+
 func TestRun_error(t *testing.T) {
 	testCases := []struct {
 		opts      *Opts
@@ -166,7 +192,7 @@ func TestRun_alpine(t *testing.T) {
 				Image:      "ghcr.io/zetaoss/runcontainers/java",
 				Command:    `javac -d bin -cp "lib/*" src/*; java -cp "bin:lib/*" App`,
 				WorkingDir: "/demo",
-				Files:      []File{{"/demo/src/App.java", `public class App{public static void main(String args[]){System.out.println("hello");}}`}},
+				Files:      []File{{Name: "/demo/src/App.java", Body: `public class App{public static void main(String args[]){System.out.println("hello");}}`}},
 			},
 			&Result{
 				Logs: []Log{{Stream: 1, Log: "hello"}},
@@ -205,7 +231,7 @@ func TestRun_language(t *testing.T) {
 				Image:      "ghcr.io/zetaoss/runcontainers/java",
 				Command:    `javac -d bin -cp "lib/*" src/*; java -cp "bin:lib/*" App`,
 				WorkingDir: "/demo",
-				Files:      []File{{"/demo/src/App.java", `public class App{public static void main(String args[]){System.out.println("hello");}}`}},
+				Files:      []File{{Name: "/demo/src/App.java", Body: `public class App{public static void main(String args[]){System.out.println("hello");}}`}},
 			},
 			&Result{
 				Logs: []Log{{Stream: 1, Log: "hello"}},
@@ -271,7 +297,7 @@ func TestRun_files(t *testing.T) {
 	}{
 		{
 			&Opts{Image: "alpine", Command: "cat /tmp/hello.txt", Files: []File{
-				{"/tmp/hello.txt", "world"},
+				{Name: "/tmp/hello.txt", Body: "world"},
 			}},
 			&Result{
 				Logs:     []Log{{Stream: 1, Log: "world"}},
@@ -283,7 +309,7 @@ func TestRun_files(t *testing.T) {
 		},
 		{
 			&Opts{Image: "ghcr.io/zetaoss/runcontainers/python", Shell: "python", Command: "print(open('/tmp/hello.txt').read())", Files: []File{
-				{"/tmp/hello.txt", "world"},
+				{Name: "/tmp/hello.txt", Body: "world"},
 			}},
 			&Result{
 				Logs: []Log{{Stream: 1, Log: "world"}},
@@ -420,7 +446,7 @@ func TestRun_images(t *testing.T) {
 				Command:       `javac -d bin -cp "lib/*" src/*; java -cp "bin:lib/*" App`,
 				WorkingDir:    "/demo",
 				Files: []File{{
-					"/demo/src/App.java", `
+					Name: "/demo/src/App.java", Body: `
 					import java.awt.Graphics2D;
 					import java.awt.image.BufferedImage;
 					import java.io.File;
@@ -454,7 +480,7 @@ func TestRun_images(t *testing.T) {
 				Command:       `javac -d bin -cp "lib/*" src/*; java -cp "bin:lib/*" App`,
 				WorkingDir:    "/demo",
 				Files: []File{{
-					"/demo/src/App.java", `
+					Name: "/demo/src/App.java", Body: `
 					import java.awt.Graphics2D;
 					import java.awt.image.BufferedImage;
 					import java.io.File;
@@ -510,8 +536,8 @@ func TestRun_tex(t *testing.T) {
 				WorkingDir:    "/home/user01",
 				User:          "root",
 				Files: []File{{
-					"/home/user01/runbox.tex",
-					"\\documentclass{article}\n\\usepackage[a6paper,landscape]{geometry}\n\\begin{document}\nHello world!\n\\end{document}",
+					Name: "/home/user01/runbox.tex",
+					Body: "\\documentclass{article}\n\\usepackage[a6paper,landscape]{geometry}\n\\begin{document}\nHello world!\n\\end{document}",
 				}},
 			},
 			&Result{Logs: []Log{
@@ -547,8 +573,8 @@ func TestRun_tex(t *testing.T) {
 				WorkingDir:         "/home/user01",
 				User:               "root",
 				Files: []File{{
-					"/home/user01/runbox.tex",
-					"\\documentclass{article}\\usepackage[a6paper,landscape]{geometry}" +
+					Name: "/home/user01/runbox.tex",
+					Body: "\\documentclass{article}\\usepackage[a6paper,landscape]{geometry}" +
 						"\\begin{document}\nLorem Ipsum 1\n" +
 						"\\newpage\nLorem Ipsum 2\n" +
 						"\\newpage\nLorem Ipsum 3\n" +
@@ -0,0 +1,123 @@
+package box
+
+import (
+	"encoding/base64"
+	"io"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	defaultMaxImageBytes    = 100 * 1024       // 100KiB
+	defaultMaxArtifactBytes = 10 * 1024 * 1024 // 10MiB
+)
+
+type Artifact struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	Base64 string `json:"base64,omitempty"`
+	// Omitted is set when the file is over the size limit and not returned.
+	Omitted bool `json:"omitted,omitempty"`
+}
+
+type namedImage struct {
+	name string
+	size int64
+	data string
+}
+
+func isImage(name string) bool {
+	ext := path.Ext(name)
+	return ext == ".png" || ext == ".svg"
+}
+
+// collector gathers the PNG and SVG images and requested artifacts a run leaves in
+// its working directory, whichever way the backend lists them.
+type collector struct {
+	opts *Opts
+	// images holds at most CollectImagesCount images, the first by name.
+	images    []namedImage
+	artifacts []Artifact
+	skipped   int
+}
+
+func (c *collector) wants(name string) bool {
+	return c.opts.CollectImages && isImage(name) || slices.Contains(c.opts.Artifacts, name)
+}
+
+// add takes a file by its path relative to the working directory.
+func (c *collector) add(name string, size int64, r io.Reader) error {
+	if !c.wants(name) {
+		return nil
+	}
+	image := c.opts.CollectImages && isImage(name)
+	artifact := slices.Contains(c.opts.Artifacts, name)
+	if image && (size > c.opts.MaxImageBytes || !c.fits(name)) {
+		c.skipped++
+		image = false
+	}
+	if artifact && size > c.opts.MaxArtifactBytes {
+		c.artifacts = append(c.artifacts, Artifact{Name: name, Size: size, Omitted: true})
+		artifact = false
+	}
+	if !image && !artifact {
+		return nil
+	}
+	data, err := io.ReadAll(io.LimitReader(r, size))
+	if err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString(data)
+	if image {
+		i, _ := slices.BinarySearchFunc(c.images, name, func(img namedImage, name string) int {
+			return strings.Compare(img.name, name)
+		})
+		c.images = slices.Insert(c.images, i, namedImage{name, size, encoded})
+		if len(c.images) > c.opts.CollectImagesCount {
+			// The last image by name is displaced.
+			c.images = c.images[:c.opts.CollectImagesCount]
+			c.skipped++
+		}
+	}
+	if artifact {
+		c.artifacts = append(c.artifacts, Artifact{Name: name, Size: size, Base64: encoded})
+	}
+	return nil
+}
+
+// fits reports whether an image named name would be among the images kept,
+// before anything is read.
+func (c *collector) fits(name string) bool {
+	n := len(c.images)
+	return n < c.opts.CollectImagesCount || n > 0 && name < c.images[n-1].name
+}
+
+// finish returns images in name order until the count or the total size
+// budget is reached, and artifacts in the order they were asked for.
+func (c *collector) finish(result *Result) {
+	var total int64
+	var formats []string
+	svg := false
+	for i, img := range c.images {
+		if len(result.Images) >= c.opts.CollectImagesCount ||
+			c.opts.MaxImagesBytes > 0 && total+img.size > c.opts.MaxImagesBytes {
+			// later images are left out too so the ones returned stay in order
+			c.skipped += len(c.images) - i
+			break
+		}
+		total += img.size
+		result.Images = append(result.Images, img.data)
+		formats = append(formats, path.Ext(img.name)[1:])
+		svg = svg || path.Ext(img.name) == ".svg"
+	}
+	if svg {
+		result.ImageFormats = formats
+	}
+	result.SkippedImages = c.skipped
+	sort.SliceStable(c.artifacts, func(i, j int) bool {
+		return slices.Index(c.opts.Artifacts, c.artifacts[i].Name) < slices.Index(c.opts.Artifacts, c.artifacts[j].Name)
+	})
+	result.Artifacts = c.artifacts
+}
@@ -0,0 +1,90 @@
+package box
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollector(t *testing.T) {
+	opts := &Opts{
+		CollectImages:      true,
+		CollectImagesCount: 2,
+		Artifacts:          []string{"runbox.pdf", "runbox.log", "missing.txt"},
+		MaxImageBytes:      4,
+		MaxArtifactBytes:   8,
+	}
+	files := []struct {
+		name string
+		body string
+	}{
+		{"runbox.log", "log"},
+		{"page-010.png", "p10"},
+		{"page-002.png", "p2"},
+		{"page-001.png", "p1"},
+		{"big.png", "too big"},
+		{"runbox.pdf", "too large pdf"},
+		{"runbox.tex", "source"},
+	}
+	c := &collector{opts: opts}
+	for _, f := range files {
+		require.NoError(t, c.add(f.name, int64(len(f.body)), strings.NewReader(f.body)))
+	}
+	var result Result
+	c.finish(&result)
+	require.Equal(t, []string{"cDE=", "cDI="}, result.Images)
+	require.Equal(t, 2, result.SkippedImages)
+	require.Equal(t, []Artifact{
+		{Name: "runbox.pdf", Size: 13, Omitted: true},
+		{Name: "runbox.log", Size: 3, Base64: "bG9n"},
+	}, result.Artifacts)
+}
+
+func TestCollector_budget(t *testing.T) {
+	opts := &Opts{
+		CollectImages:      true,
+		CollectImagesCount: 10,
+		MaxImageBytes:      100,
+		MaxImagesBytes:     10,
+	}
+	files := []struct {
+		name string
+		body string
+	}{
+		{"plot-003.png", "ccccc"},
+		{"plot-002.svg", "bbbb"},
+		{"plot-001.png", "aaaa"},
+		{"plot-004.png", "d"},
+	}
+	c := &collector{opts: opts}
+	for _, f := range files {
+		require.NoError(t, c.add(f.name, int64(len(f.body)), strings.NewReader(f.body)))
+	}
+	var result Result
+	c.finish(&result)
+	require.Equal(t, []string{"YWFhYQ==", "YmJiYg=="}, result.Images)
+	require.Equal(t, []string{"png", "svg"}, result.ImageFormats)
+	require.Equal(t, 2, result.SkippedImages)
+}
+
+// unreadable fails the collector if it reads an image it cannot keep.
+type unreadable struct{}
+
+func (unreadable) Read([]byte) (int, error) { return 0, errors.New("read") }
+
+func TestCollector_count(t *testing.T) {
+	opts := &Opts{CollectImages: true, CollectImagesCount: 2, MaxImageBytes: 100}
+	c := &collector{opts: opts}
+	require.NoError(t, c.add("c.png", 1, strings.NewReader("c")))
+	require.NoError(t, c.add("b.png", 1, strings.NewReader("b")))
+	require.NoError(t, c.add("d.png", 1, unreadable{}))
+	require.NoError(t, c.add("a.png", 1, strings.NewReader("a")))
+	require.NoError(t, c.add("e.png", 1, unreadable{}))
+	require.Len(t, c.images, 2)
+	var result Result
+	c.finish(&result)
+	require.Equal(t, []string{"YQ==", "Yg=="}, result.Images)
+	require.Equal(t, 3, result.SkippedImages)
+}
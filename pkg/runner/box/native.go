@@ -0,0 +1,46 @@
+package box
+
+import (
+	"fmt"
+)
+
+const nativeInitArg = "runbox-native-init"
+
+// Native runs commands in Linux namespaces directly, for hosts without a Docker daemon.
+// Each run gets a throwaway overlay over its rootfs, which stays unchanged, and
+// runs without capabilities under a seccomp filter.
+type Native struct {
+	// Roots maps an image name to a rootfs directory on the host.
+	Roots       map[string]string
+	DefaultRoot string
+	// CgroupRoot is a delegated cgroup v2 directory. Limits and stats fall back
+	// to rusage when it is empty.
+	CgroupRoot string
+	// MemoryLimit, in bytes, caps every run, whatever memory it asks for.
+	MemoryLimit int64
+	PidsLimit   int64
+}
+
+func NewNative(n *Native) *Box {
+	return &Box{native: n, limits: DefaultLimits}
+}
+
+func (n *Native) rootFor(image string) (string, error) {
+	if root, ok := n.Roots[image]; ok {
+		return root, nil
+	}
+	if n.DefaultRoot != "" {
+		return n.DefaultRoot, nil
+	}
+	return "", fmt.Errorf("no rootfs: '%s'", image)
+}
+
+type nativeSpec struct {
+	Root       string
+	Upper      string
+	Work       string
+	Merged     string
+	Args       []string
+	Env        []string
+	WorkingDir string
+}
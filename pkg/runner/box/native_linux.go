@@ -0,0 +1,583 @@
+//go:build linux
+
+package box
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const nativeInitEnv = "_RUNBOX_NATIVE_INIT"
+
+const defaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// RunNativeInit must be called first in main. In the re-executed sandbox child
+// it sets up the namespaces and execs the command; otherwise it returns.
+func RunNativeInit() {
+	if len(os.Args) == 0 || os.Args[0] != nativeInitArg {
+		return
+	}
+	var spec nativeSpec
+	if err := json.Unmarshal([]byte(os.Getenv(nativeInitEnv)), &spec); err != nil {
+		fmt.Fprintf(os.Stderr, "runbox: bad init spec: %v\n", err)
+		os.Exit(125)
+	}
+	if err := nativeInit(&spec); err != nil {
+		fmt.Fprintf(os.Stderr, "runbox: %v\n", err)
+		os.Exit(125)
+	}
+}
+
+func nativeInit(spec *nativeSpec) error {
+	runtime.LockOSThread()
+
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("mount private err: %w", err)
+	}
+	// Every run writes to its own overlay, never to the shared rootfs.
+	data := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s,userxattr", spec.Root, spec.Upper, spec.Work)
+	if err := unix.Mount("overlay", spec.Merged, "overlay", 0, data); err != nil {
+		return fmt.Errorf("mount overlay err: %w", err)
+	}
+	root := spec.Merged
+	proc := filepath.Join(root, "proc")
+	if err := os.MkdirAll(proc, 0755); err != nil {
+		return err
+	}
+	if err := unix.Mount("proc", proc, "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("mount proc err: %w", err)
+	}
+	if err := mountDev(filepath.Join(root, "dev")); err != nil {
+		return fmt.Errorf("mountDev err: %w", err)
+	}
+	if err := unix.Sethostname([]byte("runbox")); err != nil {
+		return fmt.Errorf("sethostname err: %w", err)
+	}
+	if err := pivotRoot(root); err != nil {
+		return fmt.Errorf("pivotRoot err: %w", err)
+	}
+	workingDir := spec.WorkingDir
+	if workingDir == "" {
+		workingDir = "/"
+	}
+	if err := os.Chdir(workingDir); err != nil {
+		return fmt.Errorf("chdir err: %w", err)
+	}
+
+	env := append([]string{"PATH=" + defaultPath, "HOME=" + workingDir}, spec.Env...)
+	for _, e := range env {
+		if v, ok := strings.CutPrefix(e, "PATH="); ok {
+			if err := os.Setenv("PATH", v); err != nil {
+				return err
+			}
+		}
+	}
+	name, err := exec.LookPath(spec.Args[0])
+	if err != nil {
+		return err
+	}
+	if err := dropCapabilities(); err != nil {
+		return fmt.Errorf("dropCapabilities err: %w", err)
+	}
+	if err := installSeccomp(); err != nil {
+		return fmt.Errorf("seccomp err: %w", err)
+	}
+	return unix.Exec(name, spec.Args, env)
+}
+
+// pivotRoot makes root the root of the mount namespace and detaches the old
+// one, so that no path leads back to the host.
+func pivotRoot(root string) error {
+	if err := unix.Chdir(root); err != nil {
+		return err
+	}
+	// The old root is stacked under the new one, needing no directory of its own.
+	if err := unix.PivotRoot(".", "."); err != nil {
+		return err
+	}
+	if err := unix.Unmount(".", unix.MNT_DETACH); err != nil {
+		return err
+	}
+	return unix.Chdir("/")
+}
+
+// dropCapabilities empties the ambient and bounding sets and the thread's own,
+// so the command runs with no capabilities even as root of its namespace.
+func dropCapabilities() error {
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+		return err
+	}
+	for c := 0; ; c++ {
+		err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0)
+		if errors.Is(err, unix.EINVAL) {
+			break // past the last capability
+		}
+		if err != nil {
+			return err
+		}
+	}
+	var data [2]unix.CapUserData
+	return unix.Capset(&unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}, &data[0])
+}
+
+func mountDev(dev string) error {
+	if err := os.MkdirAll(dev, 0755); err != nil {
+		return err
+	}
+	if err := unix.Mount("tmpfs", dev, "tmpfs", unix.MS_NOSUID|unix.MS_NOEXEC, "mode=755"); err != nil {
+		return err
+	}
+	for _, name := range []string{"null", "zero", "random", "urandom"} {
+		target := filepath.Join(dev, name)
+		if err := os.WriteFile(target, nil, 0666); err != nil {
+			return err
+		}
+		if err := unix.Mount("/dev/"+name, target, "", unix.MS_BIND, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *Native) run(opts *Opts) (_ *Result, err error) {
+	setDefaults(opts)
+	var result Result
+	defer func() {
+		if err != nil {
+			err = &RunError{Err: err, Phases: result.Phases}
+		}
+	}()
+	root, err := n.rootFor(opts.Image)
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := os.MkdirTemp("", "runbox-native-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := os.RemoveAll(tmp); err != nil {
+			log.Printf("failed to remove %s: %v", tmp, err)
+		}
+	}()
+
+	spec := nativeSpec{
+		Root:       root,
+		Upper:      filepath.Join(tmp, "upper"),
+		Work:       filepath.Join(tmp, "work"),
+		Merged:     filepath.Join(tmp, "merged"),
+		Env:        execEnv(opts),
+		WorkingDir: opts.WorkingDir,
+	}
+	for _, dir := range []string{spec.Upper, spec.Work, spec.Merged} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	writeStart := time.Now()
+	err = writeFiles(spec.Upper, opts)
+	result.addPhase(PhaseWriteFiles, time.Since(writeStart))
+	if err != nil {
+		return nil, fmt.Errorf("writeFiles err: %w", err)
+	}
+
+	cg, err := n.newCgroup(filepath.Base(tmp), opts.Memory, opts.Priority)
+	if err != nil {
+		return nil, fmt.Errorf("newCgroup err: %w", err)
+	}
+	if cg != nil {
+		defer cg.remove()
+	}
+
+	limit := newOutputLimit(opts)
+	startTime := time.Now()
+	deadline := startTime.Add(time.Duration(opts.Timeout) * time.Millisecond)
+	var state *os.ProcessState
+	compiled := true
+	if opts.Compile != "" {
+		compileOpts := *opts
+		compileOpts.Base64Binary = false
+		stdout, stderr := newLogWriters(&result.Logs, &compileOpts, limit)
+		spec.Args = []string{opts.Shell, "-c", opts.Compile}
+		state, result.Timedout, err = n.start(&result, spec, cg, false, nil, stdout, stderr, deadline)
+		if err != nil {
+			return nil, err
+		}
+		stdout.Close()
+		stderr.Close()
+		result.CompileLogs = len(result.Logs)
+		if !result.Timedout {
+			result.Code = state.ExitCode()
+		}
+		compiled = !result.Timedout && result.Code == 0
+	}
+	if compiled {
+		stdout, stderr := newLogWriters(&result.Logs, opts, limit)
+		spec.Args = opts.argv()
+		state, result.Timedout, err = n.start(&result, spec, cg, opts.Tty, nil, stdout, stderr, deadline)
+		if err != nil {
+			return nil, err
+		}
+		stdout.Close()
+		stderr.Close()
+		applyBase64(&result, stdout, stderr)
+		if !result.Timedout {
+			result.Code = state.ExitCode()
+		}
+	}
+	result.Time = int(time.Since(startTime).Milliseconds())
+	result.addPhase(PhaseExec, time.Since(startTime))
+	result.OutputTruncated = limit.wasTruncated()
+	if *opts.CollectStats {
+		statsStart := time.Now()
+		result.CPU, result.MEM = nativeStats(state, cg)
+		result.addPhase(PhaseStats, time.Since(statsStart))
+	}
+	if len(opts.Steps) > 0 && result.Code == 0 && !result.Timedout {
+		stepsStart := time.Now()
+		err = n.runSteps(&result, spec, opts, filepath.Base(tmp))
+		result.addPhase(PhaseSteps, time.Since(stepsStart))
+		if err != nil {
+			return nil, fmt.Errorf("runSteps err: %w", err)
+		}
+	}
+	if opts.CollectImages || len(opts.Artifacts) > 0 {
+		imagesStart := time.Now()
+		err = collectNativeFiles(filepath.Join(spec.Upper, opts.WorkingDir), opts, &result)
+		result.addPhase(PhaseCollectImages, time.Since(imagesStart))
+		if err != nil {
+			return nil, fmt.Errorf("collectImages err: %w", err)
+		}
+	}
+	return &result, nil
+}
+
+// start runs spec in fresh namespaces until it exits or the deadline
+// passes, when it is killed. stdin, when set, is its input.
+func (n *Native) start(result *Result, spec nativeSpec, cg *cgroup, tty bool, stdin io.Reader, stdout, stderr io.Writer, deadline time.Time) (*os.ProcessState, bool, error) {
+	specJSON, err := json.Marshal(spec)
+	if err != nil {
+		return nil, false, err
+	}
+	cmd := &exec.Cmd{
+		Path:   "/proc/self/exe",
+		Args:   []string{nativeInitArg},
+		Env:    []string{nativeInitEnv + "=" + string(specJSON)},
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+		SysProcAttr: &syscall.SysProcAttr{
+			Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWPID | syscall.CLONE_NEWNS |
+				syscall.CLONE_NEWNET | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS,
+			UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+			GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+			Pdeathsig:   syscall.SIGKILL,
+		},
+	}
+	if cg != nil {
+		cmd.SysProcAttr.UseCgroupFD = true
+		cmd.SysProcAttr.CgroupFD = int(cg.fd.Fd())
+	}
+	var slave *os.File
+	var ptyDone chan struct{}
+	if tty {
+		var master *os.File
+		master, slave, err = openPty()
+		if err != nil {
+			return nil, false, fmt.Errorf("openPty err: %w", err)
+		}
+		defer func() {
+			_ = master.Close()
+		}()
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+		cmd.SysProcAttr.Setsid = true
+		cmd.SysProcAttr.Setctty = true
+		ptyDone = make(chan struct{})
+		go func() {
+			// Reading the master fails with EIO once every slave fd is closed.
+			_, _ = io.Copy(stdout, master)
+			close(ptyDone)
+		}()
+	}
+
+	startTime := time.Now()
+	err = cmd.Start()
+	result.addPhase(PhaseStart, time.Since(startTime))
+	if slave != nil {
+		_ = slave.Close()
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("start err: %w", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	timedout := false
+	var waitErr error
+	select {
+	case <-time.After(time.Until(deadline)):
+		timedout = true
+		// The child is pid 1 of its namespace, so killing it takes down every descendant.
+		_ = cmd.Process.Kill()
+		<-done
+	case waitErr = <-done:
+	}
+	if ptyDone != nil {
+		<-ptyDone
+	}
+	var exitErr *exec.ExitError
+	if waitErr != nil && !errors.As(waitErr, &exitErr) {
+		return nil, false, fmt.Errorf("wait err: %w", waitErr)
+	}
+	return cmd.ProcessState, timedout, nil
+}
+
+// runSteps runs each step in a cgroup of its own, which holds its memory
+// limit.
+func (n *Native) runSteps(result *Result, spec nativeSpec, opts *Opts, name string) error {
+	for i, step := range opts.Steps {
+		cg, err := n.newCgroup(fmt.Sprintf("%s-%d", name, i), stepMemory(step, opts), opts.Priority)
+		if err != nil {
+			return fmt.Errorf("newCgroup err: %w", err)
+		}
+		limit := newOutputLimit(opts)
+		stdout, stderr := &stepWriter{limit: limit}, &stepWriter{limit: limit}
+		spec.Args = step.Args
+		start := time.Now()
+		state, timedout, err := n.start(result, spec, cg, false, strings.NewReader(step.Stdin), stdout, stderr,
+			start.Add(time.Duration(stepTimeout(step, opts))*time.Millisecond))
+		if cg != nil {
+			cg.remove()
+		}
+		if err != nil {
+			return err
+		}
+		sr := StepResult{
+			Stdout:   stdout.buf.String(),
+			Stderr:   stderr.buf.String(),
+			Time:     int(time.Since(start).Milliseconds()),
+			Timedout: timedout,
+		}
+		if !timedout {
+			sr.Code = state.ExitCode()
+		}
+		result.Steps = append(result.Steps, sr)
+	}
+	return nil
+}
+
+func openPty() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	fd := int(master.Fd())
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		_ = master.Close()
+		return nil, nil, err
+	}
+	n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err != nil {
+		_ = master.Close()
+		return nil, nil, err
+	}
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		_ = master.Close()
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
+
+func writeFiles(root string, opts *Opts) error {
+	if err := checkUploadSize(opts); err != nil {
+		return err
+	}
+	if opts.WorkingDir != "" {
+		if err := os.MkdirAll(filepath.Join(root, opts.WorkingDir), 0755); err != nil {
+			return err
+		}
+	}
+	for _, file := range opts.Files {
+		name := filepath.Join(root, filepath.Clean("/"+file.Name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return err
+		}
+		if err := writeFile(name, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeFile(name string, file File) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	r, size := file.open()
+	if _, err := io.CopyN(f, r, size); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func nativeStats(state *os.ProcessState, cg *cgroup) (int, int) {
+	if cg != nil {
+		if cpu, mem, err := cg.stats(); err == nil {
+			return cpu, mem
+		}
+	}
+	rusage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0, 0
+	}
+	cpu := rusage.Utime.Nano()/1000 + rusage.Stime.Nano()/1000
+	return int(cpu), int(rusage.Maxrss) // rusage reports kibibytes
+}
+
+func collectNativeFiles(dir string, opts *Opts, result *Result) error {
+	c := &collector{opts: opts}
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil || !d.Type().IsRegular() || !c.wants(filepath.ToSlash(rel)) {
+			return err
+		}
+		// The run may have swapped the file for a symlink to a host file.
+		f, err := os.OpenFile(name, os.O_RDONLY|unix.O_NOFOLLOW|unix.O_NONBLOCK, 0)
+		if errors.Is(err, unix.ELOOP) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		return c.add(filepath.ToSlash(rel), info.Size(), f)
+	})
+	if err != nil {
+		return err
+	}
+	c.finish(result)
+	return nil
+}
+
+type cgroup struct {
+	dir string
+	fd  *os.File
+}
+
+// cpuWeights is cpuShares for cgroup v2, whose default weight is 100.
+var cpuWeights = map[string]int64{
+	PriorityLow:  50,
+	PriorityHigh: 200,
+}
+
+func (n *Native) newCgroup(name string, memory int64, priority string) (*cgroup, error) {
+	if n.CgroupRoot == "" {
+		return nil, nil
+	}
+	dir := filepath.Join(n.CgroupRoot, name)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return nil, err
+	}
+	cg := &cgroup{dir: dir}
+	pidsLimit := n.PidsLimit
+	if pidsLimit == 0 {
+		pidsLimit = 100
+	}
+	if err := cg.write("pids.max", strconv.FormatInt(pidsLimit, 10)); err != nil {
+		cg.remove()
+		return nil, err
+	}
+	// MemoryLimit caps what a spec or request asks for.
+	if memory <= 0 || n.MemoryLimit > 0 && n.MemoryLimit < memory {
+		memory = n.MemoryLimit
+	}
+	if memory > 0 {
+		if err := cg.write("memory.max", strconv.FormatInt(memory, 10)); err != nil {
+			cg.remove()
+			return nil, err
+		}
+	}
+	if weight, ok := cpuWeights[priority]; ok {
+		if err := cg.write("cpu.weight", strconv.FormatInt(weight, 10)); err != nil {
+			cg.remove()
+			return nil, err
+		}
+	}
+	fd, err := os.Open(dir)
+	if err != nil {
+		cg.remove()
+		return nil, err
+	}
+	cg.fd = fd
+	return cg, nil
+}
+
+func (cg *cgroup) write(name, value string) error {
+	return os.WriteFile(filepath.Join(cg.dir, name), []byte(value), 0644)
+}
+
+func (cg *cgroup) stats() (int, int, error) {
+	f, err := os.Open(filepath.Join(cg.dir, "cpu.stat"))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Printf("failed to close cpu.stat: %v", err)
+		}
+	}()
+	cpu := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if v, ok := strings.CutPrefix(scanner.Text(), "usage_usec "); ok {
+			cpu, _ = strconv.Atoi(v)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(cg.dir, "memory.peak"))
+	if err != nil {
+		return 0, 0, err
+	}
+	mem, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, 0, err
+	}
+	return cpu, mem / 1024, nil
+}
+
+func (cg *cgroup) remove() {
+	if cg.fd != nil {
+		_ = cg.fd.Close()
+	}
+	if err := os.Remove(cg.dir); err != nil {
+		log.Printf("failed to remove cgroup %s: %v", cg.dir, err)
+	}
+}
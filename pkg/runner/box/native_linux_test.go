@@ -0,0 +1,205 @@
+//go:build linux
+
+package box
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zetaoss/runbox/pkg/apperror"
+	"github.com/zetaoss/runbox/pkg/testutil"
+	"golang.org/x/sys/unix"
+)
+
+func TestMain(m *testing.M) {
+	RunNativeInit()
+	os.Exit(m.Run())
+}
+
+func TestSeccompFilter(t *testing.T) {
+	filter := seccompFilter(unix.AUDIT_ARCH_AARCH64, []uint32{1, 2})
+	require.Len(t, filter, 4+7+2*2+1)
+	require.Equal(t, uint32(unix.AUDIT_ARCH_AARCH64), filter[1].K)
+	require.Equal(t, uint32(unix.SECCOMP_RET_ALLOW), filter[len(filter)-1].K)
+
+	filter = seccompFilter(unix.AUDIT_ARCH_X86_64, []uint32{1, 2})
+	require.Len(t, filter, 4+2+7+2*2+1)
+}
+
+func TestCollectNativeFiles_symlink(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "secret.png")
+	require.NoError(t, os.WriteFile(secret, []byte("host"), 0644))
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.png"), []byte("png"), 0644))
+	require.NoError(t, os.Symlink(secret, filepath.Join(dir, "b.png")))
+	require.NoError(t, os.Symlink(secret, filepath.Join(dir, "runbox.log")))
+
+	opts := &Opts{CollectImages: true, CollectImagesCount: 10, MaxImageBytes: 1024, Artifacts: []string{"runbox.log"}, MaxArtifactBytes: 1024}
+	result := &Result{}
+	require.NoError(t, collectNativeFiles(dir, opts, result))
+	require.Equal(t, []string{"cG5n"}, result.Images)
+	require.Empty(t, result.Artifacts)
+}
+
+func TestNewCgroup_memory(t *testing.T) {
+	testCases := []struct {
+		limit, memory int64
+		want          string
+	}{
+		{0, 0, ""},
+		{0, 2 << 30, "2147483648"},
+		{1 << 30, 0, "1073741824"},
+		{1 << 30, 2 << 30, "1073741824"},
+		{1 << 30, 512 << 20, "536870912"},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.limit, tc.memory), func(t *testing.T) {
+			n := &Native{CgroupRoot: t.TempDir(), MemoryLimit: tc.limit}
+			cg, err := n.newCgroup("run", tc.memory, "")
+			require.NoError(t, err)
+			data, _ := os.ReadFile(filepath.Join(cg.dir, "memory.max"))
+			require.Equal(t, tc.want, string(data))
+			require.NoError(t, cg.fd.Close())
+		})
+	}
+}
+
+// newRootfs copies a few host binaries and their shared libraries into a fresh rootfs.
+func newRootfs(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, name := range []string{"bin", "lib", "lib64", "sbin"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, "usr", name), 0755))
+		if target, err := os.Readlink("/" + name); err == nil {
+			require.NoError(t, os.Symlink(target, filepath.Join(root, name)))
+		}
+	}
+	copyFile := func(name string) {
+		data, err := os.ReadFile(name)
+		require.NoError(t, err)
+		require.NoError(t, os.MkdirAll(filepath.Join(root, filepath.Dir(name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(root, name), data, 0755))
+	}
+	for _, bin := range []string{"sh", "cat", "hostname", "unshare", "sleep", "true"} {
+		name, err := exec.LookPath(bin)
+		require.NoError(t, err)
+		copyFile(name)
+		out, err := exec.Command("ldd", name).Output()
+		require.NoError(t, err)
+		for _, lib := range regexp.MustCompile(`(/[^\s]+) \(0x`).FindAllStringSubmatch(string(out), -1) {
+			copyFile(lib[1])
+		}
+		// Keep the loader at its well-known path too.
+		for _, lib := range regexp.MustCompile(`(?m)^\s*(/[^\s]+)`).FindAllStringSubmatch(string(out), -1) {
+			copyFile(lib[1])
+		}
+	}
+	return root
+}
+
+func TestNative_runError(t *testing.T) {
+	native := NewNative(&Native{DefaultRoot: t.TempDir()})
+	_, err := native.Run(&Opts{Files: []File{{Name: "a", Body: "ab"}}, MaxUploadBytes: 1})
+	var runErr *RunError
+	require.ErrorAs(t, err, &runErr)
+	require.ErrorIs(t, err, apperror.ErrUploadTooLarge)
+	require.Contains(t, runErr.Phases, PhaseWriteFiles)
+}
+
+func TestNative_run(t *testing.T) {
+	native := NewNative(&Native{DefaultRoot: newRootfs(t)})
+	testCases := []struct {
+		opts *Opts
+		want *Result
+	}{
+		{
+			&Opts{Command: "echo hello"},
+			&Result{Logs: []Log{{Stream: 1, Log: "hello"}}},
+		},
+		{
+			&Opts{Command: "echo hello >&2; exit 42"},
+			&Result{Logs: []Log{{Stream: 2, Log: "hello"}}, Code: 42},
+		},
+		{
+			&Opts{Command: "cat greet.txt; hostname", WorkingDir: "/home/user01", Files: []File{{Name: "/home/user01/greet.txt", Body: "hi\n"}}},
+			&Result{Logs: []Log{{Stream: 1, Log: "hi"}, {Stream: 1, Log: "runbox"}}},
+		},
+		{
+			&Opts{Command: "echo $$; unshare -U true 2>/dev/null || echo denied"},
+			&Result{Logs: []Log{{Stream: 1, Log: "1"}, {Stream: 1, Log: "denied"}}},
+		},
+		{
+			&Opts{Command: "while read k v; do case $k in CapEff:|CapBnd:|CapAmb:) echo $k $v;; esac; done < /proc/self/status"},
+			&Result{Logs: []Log{{Stream: 1, Log: "CapEff: 0000000000000000"}, {Stream: 1, Log: "CapBnd: 0000000000000000"}, {Stream: 1, Log: "CapAmb: 0000000000000000"}}},
+		},
+		{
+			&Opts{Command: "while read id parent major root target rest; do echo $target; done < /proc/self/mountinfo"},
+			&Result{Logs: []Log{{Stream: 1, Log: "/"}, {Stream: 1, Log: "/proc"}, {Stream: 1, Log: "/dev"}, {Stream: 1, Log: "/dev/null"},
+				{Stream: 1, Log: "/dev/zero"}, {Stream: 1, Log: "/dev/random"}, {Stream: 1, Log: "/dev/urandom"}}},
+		},
+		{
+			&Opts{Command: "test -t 1 || echo notty", Tty: false},
+			&Result{Logs: []Log{{Stream: 1, Log: "notty"}}},
+		},
+		{
+			&Opts{Command: "test -t 1 && echo $TERM; echo err >&2", Tty: true},
+			&Result{Logs: []Log{{Stream: 1, Log: "xterm-256color"}, {Stream: 1, Log: "err"}}},
+		},
+		{
+			&Opts{Args: []string{"cat", "a; echo pwned", "$(hostname)"}, WorkingDir: "/home/user01", Files: []File{{Name: "/home/user01/a; echo pwned", Body: "safe\n"}, {Name: "/home/user01/$(hostname)", Body: "literal\n"}}},
+			&Result{Logs: []Log{{Stream: 1, Log: "safe"}, {Stream: 1, Log: "literal"}}},
+		},
+		{
+			&Opts{Command: "true", WorkingDir: "/home/user01", CollectImages: true, Artifacts: []string{"out.txt"}, Files: []File{
+				{Name: "/home/user01/b.png", Body: "b"}, {Name: "/home/user01/a.png", Body: "a"}, {Name: "/home/user01/out.txt", Body: "hi"},
+			}},
+			&Result{Images: []string{"YQ==", "Yg=="}, Artifacts: []Artifact{{Name: "out.txt", Size: 2, Base64: "aGk="}}},
+		},
+		{
+			&Opts{Compile: "echo built >&2; echo ran > bin", Command: "cat bin", WorkingDir: "/home/user01"},
+			&Result{Logs: []Log{{Stream: 2, Log: "built"}, {Stream: 1, Log: "ran"}}, CompileLogs: 1},
+		},
+		{
+			&Opts{Compile: "echo failed; exit 3", Command: "echo ran"},
+			&Result{Logs: []Log{{Stream: 1, Log: "failed"}}, Code: 3, CompileLogs: 1},
+		},
+		{
+			&Opts{Command: "echo secret > ans", WorkingDir: "/home/user01", Steps: []Step{
+				{Args: []string{"cat"}, Stdin: "in\n"},
+				{Args: []string{"sh", "-c", "cat ans; echo err >&2; exit 2"}},
+				{Args: []string{"sleep", "3"}, Timeout: 500},
+			}},
+			&Result{Steps: []StepResult{
+				{Stdout: "in\n"},
+				{Stdout: "secret\n", Stderr: "err\n", Code: 2},
+				{Timedout: true},
+			}},
+		},
+		{
+			&Opts{Command: "exit 1", Steps: []Step{{Args: []string{"true"}}}},
+			&Result{Code: 1},
+		},
+		{
+			&Opts{Command: "echo hello; sleep 3", Timeout: 500},
+			&Result{Logs: []Log{{Stream: 1, Log: "hello"}}, Timedout: true},
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.opts.Command, tc.opts.Args), func(t *testing.T) {
+			tc.opts.CollectStats = new(bool)
+			got, err := native.Run(tc.opts)
+			require.NoError(t, err)
+			tc.want.Time = got.Time
+			for i := range got.Steps {
+				tc.want.Steps[i].Time = got.Steps[i].Time
+			}
+			require.Contains(t, got.Phases, PhaseExec)
+			tc.want.Phases = got.Phases
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package box
+
+import (
+	"errors"
+)
+
+func RunNativeInit() {}
+
+func (n *Native) run(opts *Opts) (*Result, error) {
+	return nil, errors.New("native backend requires linux")
+}
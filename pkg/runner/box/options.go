@@ -0,0 +1,170 @@
+package box
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/zetaoss/runbox/pkg/apperror"
+)
+
+const (
+	PriorityLow    = "low"
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+)
+
+// RunOptions are what a request may change about one run. Zero values keep
+// the runner's own settings.
+type RunOptions struct {
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+	// MemoryMB can lower the memory the runner gives a run, not raise it.
+	MemoryMB    int      `json:"memoryMB,omitempty"`
+	Artifacts   []string `json:"artifacts,omitempty"`
+	MaxOutputKB int      `json:"maxOutputKB,omitempty"`
+	// Network, when true, gives the run a network; runs have none otherwise.
+	Network  *bool  `json:"network,omitempty"`
+	Priority string `json:"priority,omitempty"`
+	// Sink receives each line of output as soon as it is complete. It is
+	// for callers in Go; the HTTP API returns output once the run ends.
+	Sink func(Log) `json:"-"`
+}
+
+// Limits are the server's caps on RunOptions. MaxOutputKB also caps runs that
+// do not ask for a limit, and without AllowNetwork no run may ask for a
+// network.
+type Limits struct {
+	MaxTimeoutSeconds int  `json:"maxTimeoutSeconds"`
+	MaxMemoryMB       int  `json:"maxMemoryMB"`
+	MaxOutputKB       int  `json:"maxOutputKB"`
+	AllowNetwork      bool `json:"allowNetwork"`
+	AllowHighPriority bool `json:"allowHighPriority"`
+}
+
+var DefaultLimits = Limits{
+	MaxTimeoutSeconds: 120,
+	MaxMemoryMB:       4096,
+	MaxOutputKB:       10 * 1024,
+	AllowNetwork:      true,
+}
+
+func (o RunOptions) validate(l Limits) error {
+	check := func(name string, v, max int) error {
+		if v < 0 || v > max {
+			return fmt.Errorf("%w: %s must be 0 to %d", apperror.ErrInvalidOptions, name, max)
+		}
+		return nil
+	}
+	if err := check("timeoutSeconds", o.TimeoutSeconds, l.MaxTimeoutSeconds); err != nil {
+		return err
+	}
+	if err := check("memoryMB", o.MemoryMB, l.MaxMemoryMB); err != nil {
+		return err
+	}
+	if err := check("maxOutputKB", o.MaxOutputKB, l.MaxOutputKB); err != nil {
+		return err
+	}
+	for _, name := range o.Artifacts {
+		if name == "" || path.IsAbs(name) || path.Clean(name) != name || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("%w: invalid artifact '%s'", apperror.ErrInvalidOptions, name)
+		}
+	}
+	if o.Network != nil && *o.Network && !l.AllowNetwork {
+		return fmt.Errorf("%w: network not allowed", apperror.ErrInvalidOptions)
+	}
+	switch o.Priority {
+	case "", PriorityLow, PriorityNormal:
+	case PriorityHigh:
+		if !l.AllowHighPriority {
+			return fmt.Errorf("%w: priority 'high' not allowed", apperror.ErrInvalidOptions)
+		}
+	default:
+		return fmt.Errorf("%w: unknown priority '%s'", apperror.ErrInvalidOptions, o.Priority)
+	}
+	return nil
+}
+
+// Apply checks the options against the limits and sets them on opts.
+func (o RunOptions) Apply(opts *Opts, l Limits) error {
+	if err := o.validate(l); err != nil {
+		return err
+	}
+	if o.TimeoutSeconds > 0 {
+		opts.Timeout = o.TimeoutSeconds * 1000
+	}
+	if memory := int64(o.MemoryMB) << 20; memory > 0 && (opts.Memory == 0 || memory < opts.Memory) {
+		opts.Memory = memory
+	}
+	for _, name := range o.Artifacts {
+		if !slices.Contains(opts.Artifacts, name) {
+			opts.Artifacts = append(opts.Artifacts, name)
+		}
+	}
+	maxOutput := int64(o.MaxOutputKB) << 10
+	if maxOutput == 0 {
+		maxOutput = int64(l.MaxOutputKB) << 10
+	}
+	if opts.MaxOutputBytes == 0 || maxOutput > 0 && maxOutput < opts.MaxOutputBytes {
+		opts.MaxOutputBytes = maxOutput
+	}
+	if o.Network == nil || !*o.Network {
+		opts.NetworkDisabled = true
+	}
+	if o.Priority != "" {
+		opts.Priority = o.Priority
+	}
+	if o.Sink != nil {
+		opts.OnLog = o.Sink
+	}
+	return nil
+}
+
+// stepTimeout is the step's timeout in ms, or the run's.
+func stepTimeout(step Step, opts *Opts) int {
+	if step.Timeout > 0 {
+		return step.Timeout
+	}
+	return opts.Timeout
+}
+
+// stepMemory is the step's memory limit, kept within the run's.
+func stepMemory(step Step, opts *Opts) int64 {
+	if step.Memory <= 0 || opts.Memory > 0 && opts.Memory < step.Memory {
+		return opts.Memory
+	}
+	return step.Memory
+}
+
+// outputLimit caps the bytes kept from stdout and stderr together.
+type outputLimit struct {
+	mu        sync.Mutex
+	remaining int64
+	truncated bool
+}
+
+func newOutputLimit(opts *Opts) *outputLimit {
+	if opts.MaxOutputBytes <= 0 {
+		return nil
+	}
+	return &outputLimit{remaining: opts.MaxOutputBytes}
+}
+
+func (l *outputLimit) take(p []byte) []byte {
+	if l == nil {
+		return p
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+		l.truncated = true
+	}
+	l.remaining -= int64(len(p))
+	return p
+}
+
+func (l *outputLimit) wasTruncated() bool {
+	return l != nil && l.truncated
+}
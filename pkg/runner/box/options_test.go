@@ -0,0 +1,87 @@
+package box
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zetaoss/runbox/pkg/testutil"
+	"k8s.io/utils/ptr"
+)
+
+func TestRunOptions_Apply(t *testing.T) {
+	limits := Limits{MaxTimeoutSeconds: 30, MaxMemoryMB: 1024, MaxOutputKB: 64, AllowNetwork: true}
+	base := Opts{Timeout: 10000, Memory: 256 << 20, Artifacts: []string{"runbox.pdf"}}
+	testCases := []struct {
+		runOpts   RunOptions
+		limits    Limits
+		want      Opts
+		wantError string
+	}{
+		{
+			RunOptions{},
+			limits,
+			Opts{Timeout: 10000, Memory: 256 << 20, Artifacts: []string{"runbox.pdf"}, MaxOutputBytes: 64 << 10, NetworkDisabled: true},
+			"",
+		},
+		{
+			RunOptions{TimeoutSeconds: 30, MemoryMB: 128, Artifacts: []string{"runbox.pdf", "out/a.csv"}, MaxOutputKB: 1, Network: ptr.To(false), Priority: PriorityLow},
+			limits,
+			Opts{Timeout: 30000, Memory: 128 << 20, Artifacts: []string{"runbox.pdf", "out/a.csv"}, MaxOutputBytes: 1 << 10, NetworkDisabled: true, Priority: PriorityLow},
+			"",
+		},
+		{
+			RunOptions{MemoryMB: 512, Network: ptr.To(true)},
+			limits,
+			Opts{Timeout: 10000, Memory: 256 << 20, Artifacts: []string{"runbox.pdf"}, MaxOutputBytes: 64 << 10},
+			"",
+		},
+		{
+			RunOptions{},
+			Limits{MaxTimeoutSeconds: 30},
+			Opts{Timeout: 10000, Memory: 256 << 20, Artifacts: []string{"runbox.pdf"}, NetworkDisabled: true},
+			"",
+		},
+		{RunOptions{TimeoutSeconds: 31}, limits, Opts{}, "invalid options: timeoutSeconds must be 0 to 30"},
+		{RunOptions{MemoryMB: -1}, limits, Opts{}, "invalid options: memoryMB must be 0 to 1024"},
+		{RunOptions{MaxOutputKB: 65}, limits, Opts{}, "invalid options: maxOutputKB must be 0 to 64"},
+		{RunOptions{Artifacts: []string{"../etc/passwd"}}, limits, Opts{}, "invalid options: invalid artifact '../etc/passwd'"},
+		{RunOptions{Artifacts: []string{"/etc/passwd"}}, limits, Opts{}, "invalid options: invalid artifact '/etc/passwd'"},
+		{RunOptions{Network: ptr.To(true)}, Limits{}, Opts{}, "invalid options: network not allowed"},
+		{RunOptions{Priority: PriorityHigh}, limits, Opts{}, "invalid options: priority 'high' not allowed"},
+		{RunOptions{Priority: "urgent"}, limits, Opts{}, "invalid options: unknown priority 'urgent'"},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.runOpts), func(t *testing.T) {
+			opts := base
+			opts.Artifacts = append([]string(nil), base.Artifacts...)
+			err := tc.runOpts.Apply(&opts, tc.limits)
+			if tc.wantError != "" {
+				require.EqualError(t, err, tc.wantError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, opts)
+		})
+	}
+}
+
+func TestLogWriter_limit(t *testing.T) {
+	result := &Result{}
+	var streamed []Log
+	opts := &Opts{MaxOutputBytes: 10, OnLog: func(l Log) { streamed = append(streamed, l) }}
+	limit := newOutputLimit(opts)
+	stdout, stderr := newLogWriters(&result.Logs, opts, limit)
+	for _, w := range []struct {
+		w     *logWriter
+		chunk string
+	}{{stdout, "hello\n"}, {stderr, "oops\n"}, {stdout, "dropped\n"}} {
+		n, err := w.w.Write([]byte(w.chunk))
+		require.NoError(t, err)
+		require.Equal(t, len(w.chunk), n)
+	}
+	stdout.Close()
+	stderr.Close()
+	require.True(t, limit.wasTruncated())
+	require.Equal(t, []Log{{Stream: 1, Log: "hello"}, {Stream: 2, Log: "oops"}}, result.Logs)
+	require.Equal(t, result.Logs, streamed)
+}
@@ -0,0 +1,90 @@
+package box
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	EncodingUTF8   = ""
+	EncodingLatin1 = "latin1"
+	// EncodingAuto decodes valid UTF-8 lines as UTF-8 and anything else as Latin-1.
+	EncodingAuto = "auto"
+)
+
+func decodeLine(line []byte, encoding string) string {
+	line = bytes.TrimSuffix(line, []byte{'\r'})
+	var s string
+	switch {
+	case encoding == EncodingLatin1:
+		s = decodeLatin1(line)
+	case utf8.Valid(line):
+		s = string(line)
+	case encoding == EncodingAuto:
+		s = decodeLatin1(line)
+	default:
+		s = strings.ToValidUTF8(string(line), "�")
+	}
+	s = strings.ReplaceAll(s, "\x00", "�")
+	return collapseCR(s)
+}
+
+func decodeLatin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// collapseCR renders carriage returns the way a terminal does: each segment
+// overwrites the start of the line, so only the final state of a progress bar remains.
+func collapseCR(s string) string {
+	if !strings.Contains(s, "\r") {
+		return s
+	}
+	var line []rune
+	for _, seg := range strings.Split(s, "\r") {
+		r := []rune(seg)
+		if len(r) >= len(line) {
+			line = r
+		} else {
+			copy(line, r)
+		}
+	}
+	return string(line)
+}
+
+func isText(b []byte, encoding string) bool {
+	if bytes.IndexByte(b, 0) >= 0 {
+		return false
+	}
+	return encoding != EncodingUTF8 || utf8.Valid(b)
+}
+
+// applyBase64 replaces the logs of each non-text stream with its raw bytes in base64.
+func applyBase64(result *Result, writers ...*logWriter) {
+	for _, w := range writers {
+		if w.raw == nil || w.raw.Len() == 0 || isText(w.raw.Bytes(), w.encoding) {
+			continue
+		}
+		encoded := base64.StdEncoding.EncodeToString(w.raw.Bytes())
+		if w.stream == 1 {
+			result.StdoutBase64 = encoded
+		} else {
+			result.StderrBase64 = encoded
+		}
+		logs := result.Logs[:0]
+		for i, l := range result.Logs {
+			if i < result.CompileLogs || l.Stream != w.stream {
+				logs = append(logs, l)
+			}
+		}
+		result.Logs = logs
+	}
+	if len(result.Logs) == 0 {
+		result.Logs = nil
+	}
+}
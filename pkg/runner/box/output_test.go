@@ -0,0 +1,84 @@
+package box
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zetaoss/runbox/pkg/testutil"
+)
+
+func TestDecodeLine(t *testing.T) {
+	testCases := []struct {
+		line     string
+		encoding string
+		want     string
+	}{
+		{"hello", EncodingUTF8, "hello"},
+		{"hello\r", EncodingUTF8, "hello"},
+		{"안녕", EncodingUTF8, "안녕"},
+		{"a\x00b", EncodingUTF8, "a�b"},
+		{"caf\xe9", EncodingUTF8, "caf�"},
+		{"caf\xe9", EncodingLatin1, "café"},
+		{"caf\xe9", EncodingAuto, "café"},
+		{"안녕", EncodingAuto, "안녕"},
+		{"10%\r50%\r100%", EncodingUTF8, "100%"},
+		{"loading...\rdone", EncodingUTF8, "doneing..."},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.encoding), func(t *testing.T) {
+			require.Equal(t, tc.want, decodeLine([]byte(tc.line), tc.encoding))
+		})
+	}
+}
+
+func TestLogWriter(t *testing.T) {
+	var logs []Log
+	w := newLogWriter(1, &logs, &Opts{}, nil)
+	for _, chunk := range []string{"hel", "lo\r\nwor", "ld\n", "\xe9\xff", "\nend"} {
+		_, err := w.Write([]byte(chunk))
+		require.NoError(t, err)
+	}
+	w.Close()
+	require.Equal(t, []Log{
+		{Stream: 1, Log: "hello"},
+		{Stream: 1, Log: "world"},
+		{Stream: 1, Log: "�"},
+		{Stream: 1, Log: "end"},
+	}, logs)
+}
+
+func TestApplyBase64(t *testing.T) {
+	result := &Result{}
+	opts := &Opts{Base64Binary: true}
+	stdout, stderr := newLogWriters(&result.Logs, opts, nil)
+	_, _ = stdout.Write([]byte("\x89PNG\x00\x01\n"))
+	_, _ = stderr.Write([]byte("warning\n"))
+	stdout.Close()
+	stderr.Close()
+	applyBase64(result, stdout, stderr)
+	require.Equal(t, &Result{
+		Logs:         []Log{{Stream: 2, Log: "warning"}},
+		StdoutBase64: "iVBORwABCg==",
+	}, result)
+}
+
+func TestLogWriters_concurrent(t *testing.T) {
+	result := &Result{}
+	streamed := 0
+	opts := &Opts{OnLog: func(Log) { streamed++ }}
+	stdout, stderr := newLogWriters(&result.Logs, opts, nil)
+	var wg sync.WaitGroup
+	for _, w := range []*logWriter{stdout, stderr} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				_, _ = w.Write([]byte("line\n"))
+			}
+		}()
+	}
+	wg.Wait()
+	require.Len(t, result.Logs, 200)
+	require.Equal(t, 200, streamed)
+}
@@ -0,0 +1,109 @@
+package box
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/client"
+)
+
+var ErrCircuitOpen = errors.New("circuit open: docker daemon unavailable")
+
+type retryPolicy struct {
+	attempts int
+	base     time.Duration
+	max      time.Duration
+}
+
+var defaultRetryPolicy = retryPolicy{
+	attempts: 4,
+	base:     100 * time.Millisecond,
+	max:      2 * time.Second,
+}
+
+// isDaemonDown reports errors meaning the daemon itself is unreachable or failing.
+func isDaemonDown(err error) bool {
+	return client.IsErrConnectionFailed(err) ||
+		cerrdefs.IsUnavailable(err) ||
+		cerrdefs.IsDeadlineExceeded(err) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// isRetryable reports errors worth another attempt. Conflicts cover the
+// "removal in progress" responses seen while the daemon is cleaning up.
+func isRetryable(err error) bool {
+	return isDaemonDown(err) || cerrdefs.IsConflict(err) || cerrdefs.IsInternal(err)
+}
+
+// retry runs an idempotent call with bounded exponential backoff.
+func (p retryPolicy) retry(name string, f func() error) error {
+	delay := p.base
+	var err error
+	for i := 0; i < p.attempts; i++ {
+		if err = f(); err == nil || !isRetryable(err) {
+			return err
+		}
+		if i == p.attempts-1 {
+			break
+		}
+		log.Printf("%s failed (attempt %d/%d), retrying in %v: %v", name, i+1, p.attempts, delay, err)
+		time.Sleep(delay)
+		delay = min(delay*2, p.max)
+	}
+	return err
+}
+
+// breaker fails fast once the daemon has failed threshold times in a row, and
+// lets a single probe through after the cooldown.
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openedAt  time.Time
+	now       func() time.Time
+}
+
+func newBreaker() *breaker {
+	return &breaker{
+		threshold: 5,
+		cooldown:  10 * time.Second,
+		now:       time.Now,
+	}
+}
+
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.now().Sub(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.openedAt = b.now()
+	return true
+}
+
+func (b *breaker) closed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures < b.threshold
+}
+
+func (b *breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil || !isDaemonDown(err) {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = b.now()
+	}
+}
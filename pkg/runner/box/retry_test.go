@@ -0,0 +1,86 @@
+package box
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/stretchr/testify/require"
+	"github.com/zetaoss/runbox/pkg/testutil"
+)
+
+func TestIsRetryable(t *testing.T) {
+	testCases := []struct {
+		err           error
+		wantRetryable bool
+		wantDown      bool
+	}{
+		{errors.New("x"), false, false},
+		{cerrdefs.ErrNotFound, false, false},
+		{cerrdefs.ErrInvalidArgument, false, false},
+		{fmt.Errorf("wrapped: %w", cerrdefs.ErrConflict), true, false},
+		{cerrdefs.ErrInternal, true, false},
+		{cerrdefs.ErrUnavailable, true, true},
+		{fmt.Errorf("wrapped: %w", context.DeadlineExceeded), true, true},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.err.Error()), func(t *testing.T) {
+			require.Equal(t, tc.wantRetryable, isRetryable(tc.err))
+			require.Equal(t, tc.wantDown, isDaemonDown(tc.err))
+		})
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	p := retryPolicy{attempts: 3, base: time.Millisecond, max: 2 * time.Millisecond}
+
+	calls := 0
+	err := p.retry("x", func() error {
+		calls++
+		if calls < 3 {
+			return cerrdefs.ErrConflict
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, calls)
+
+	calls = 0
+	err = p.retry("x", func() error {
+		calls++
+		return cerrdefs.ErrUnavailable
+	})
+	require.ErrorIs(t, err, cerrdefs.ErrUnavailable)
+	require.Equal(t, 3, calls)
+
+	calls = 0
+	err = p.retry("x", func() error {
+		calls++
+		return cerrdefs.ErrNotFound
+	})
+	require.ErrorIs(t, err, cerrdefs.ErrNotFound)
+	require.Equal(t, 1, calls)
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := &breaker{threshold: 2, cooldown: time.Second, now: func() time.Time { return now }}
+
+	require.True(t, b.allow())
+	b.record(cerrdefs.ErrUnavailable)
+	require.True(t, b.allow())
+	b.record(errors.New("invalid reference format")) // the daemon answered
+	b.record(cerrdefs.ErrUnavailable)
+	require.True(t, b.allow())
+	b.record(cerrdefs.ErrUnavailable)
+	require.False(t, b.allow())
+
+	now = now.Add(time.Second)
+	require.True(t, b.allow(), "half-open probe")
+	require.False(t, b.allow(), "only one probe per cooldown")
+	b.record(nil)
+	require.True(t, b.allow())
+}
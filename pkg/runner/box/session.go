@@ -2,28 +2,46 @@ package box
 
 import (
 	"archive/tar"
-	"bytes"
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
+	cerrdefs "github.com/containerd/errdefs"
 	"github.com/distribution/reference"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/zetaoss/runbox/pkg/apperror"
 	"k8s.io/utils/ptr"
 )
 
 const staleAgeLimitSeconds int = 300
 
+// DefaultMaxUploadBytes is the upload budget of runs that set none.
+const DefaultMaxUploadBytes = 256 * 1024 * 1024 // 256MiB
+
+// lifetimeLabel records, in seconds, how long a container may live, so that
+// pruning leaves runs longer than staleAgeLimitSeconds alone.
+const lifetimeLabel = "runbox.lifetime"
+
+// lifetime is how long, in seconds, the container of a run may live: its
+// timeout and those of its steps, with room for the phases around them.
+func lifetime(opts *Opts) int {
+	timeout := opts.Timeout
+	for _, step := range opts.Steps {
+		timeout += stepTimeout(step, opts)
+	}
+	return max(staleAgeLimitSeconds, timeout/1000+staleAgeLimitSeconds/5)
+}
+
 type Session struct {
 	opts      *Opts
 	cli       *client.Client
@@ -32,9 +50,20 @@ type Session struct {
 	startTime time.Time
 	startCPU  int
 	result    Result
+	retry     retryPolicy
 }
 
 func NewSession(cli *client.Client, opts *Opts) *Session {
+	setDefaults(opts)
+	return &Session{
+		cli:   cli,
+		opts:  opts,
+		ctx:   context.Background(),
+		retry: defaultRetryPolicy,
+	}
+}
+
+func setDefaults(opts *Opts) {
 	if opts.CollectStats == nil {
 		opts.CollectStats = ptr.To(true)
 	}
@@ -50,10 +79,14 @@ func NewSession(cli *client.Client, opts *Opts) *Session {
 	if opts.Timeout == 0 {
 		opts.Timeout = 60000 // 60s
 	}
-	return &Session{
-		cli:  cli,
-		opts: opts,
-		ctx:  context.Background(),
+	if opts.MaxImageBytes == 0 {
+		opts.MaxImageBytes = defaultMaxImageBytes
+	}
+	if opts.MaxArtifactBytes == 0 {
+		opts.MaxArtifactBytes = defaultMaxArtifactBytes
+	}
+	if opts.MaxUploadBytes == 0 {
+		opts.MaxUploadBytes = DefaultMaxUploadBytes
 	}
 }
 
@@ -69,7 +102,11 @@ func (s *Session) pruneStaleContainers() {
 		containerID := ct.ID[:10]
 		containerAge := time.Since(time.Unix(ct.Created, 0))
 
-		if ct.State == "removing" || containerAge > time.Duration(staleAgeLimitSeconds)*time.Second {
+		limit := staleAgeLimitSeconds
+		if v, err := strconv.Atoi(ct.Labels[lifetimeLabel]); err == nil {
+			limit = v
+		}
+		if ct.State == "removing" || containerAge > time.Duration(limit)*time.Second {
 			containerName := "<unknown>"
 			if len(ct.Names) > 0 {
 				containerName = ct.Names[0]
@@ -91,62 +128,126 @@ func (s *Session) run() error {
 	if err := s.checkImage(); err != nil {
 		return fmt.Errorf("checkImage err: %w", err)
 	}
-	if err := s.createContainer(); err != nil {
+	if err := s.phase(PhaseCreateContainer, s.createContainer); err != nil {
 		return fmt.Errorf("createContainer err: %w", err)
 	}
-	if err := s.copyFiles(); err != nil {
+	// Remove the container whichever later phase fails.
+	defer func() {
+		_ = s.phase(PhaseContainerRemove, s.removeContainer)
+	}()
+	if err := s.phase(PhaseCopyFiles, s.copyFiles); err != nil {
 		return fmt.Errorf("copyFiles err: %w", err)
 	}
-	if err := s.cli.ContainerStart(s.ctx, s.id, container.StartOptions{}); err != nil {
+	if err := s.phase(PhaseContainerStart, func() error {
+		return s.retry.retry("ContainerStart", func() error {
+			return s.cli.ContainerStart(s.ctx, s.id, container.StartOptions{})
+		})
+	}); err != nil {
 		return fmt.Errorf("ContainerStart err: %w", err)
 	}
-	defer func() {
-		_ = s.cli.ContainerRemove(s.ctx, s.id, container.RemoveOptions{Force: true})
-	}()
 	if err := s.execute(); err != nil {
 		return fmt.Errorf("execute err: %w", err)
 	}
-	if err := s.collectImages(); err != nil {
+	if err := s.phase(PhaseSteps, s.runSteps); err != nil {
+		return fmt.Errorf("runSteps err: %w", err)
+	}
+	if err := s.phase(PhaseCollectImages, s.collectImages); err != nil {
 		return fmt.Errorf("getImages err: %w", err)
 	}
 	return nil
 }
 
-func (s *Session) checkImage() error {
-	ok, err := s.findImage()
-	if err != nil {
+func (s *Session) removeContainer() error {
+	err := s.retry.retry("ContainerRemove", func() error {
+		err := s.cli.ContainerRemove(s.ctx, s.id, container.RemoveOptions{Force: true})
+		if cerrdefs.IsNotFound(err) {
+			return nil // already gone via AutoRemove
+		}
 		return err
+	})
+	if err != nil {
+		log.Printf("failed to remove container %s: %v", s.id, err)
 	}
-	if ok {
-		return nil
+	return err
+}
+
+func (s *Session) phase(name string, f func() error) error {
+	start := time.Now()
+	err := f()
+	s.result.addPhase(name, time.Since(start))
+	return err
+}
+
+func (s *Session) checkImage() error {
+	var digest string
+	var ok bool
+	if err := s.phase(PhaseCheckImage, func() error {
+		var err error
+		digest, ok, err = s.findImage()
+		return err
+	}); err != nil {
+		return err
 	}
-	if *s.opts.PullImageIfNotPresent {
-		return s.pullImage()
+	if !ok {
+		if !*s.opts.PullImageIfNotPresent {
+			return fmt.Errorf("no image: '%s'", s.opts.Image)
+		}
+		if err := s.phase(PhasePullImage, func() error {
+			return s.retry.retry("ImagePull", s.pullImage)
+		}); err != nil {
+			return err
+		}
+		var err error
+		if digest, _, err = s.findImage(); err != nil {
+			return err
+		}
 	}
-	return fmt.Errorf("no image: '%s'", s.opts.Image)
+	s.result.ImageDigest = digest
+	return nil
 }
 
-func (s *Session) findImage() (bool, error) {
+// findImage looks the image up by tag, or by digest for name@sha256:...
+// references, and returns its repo digest (the image ID for local builds).
+func (s *Session) findImage() (string, bool, error) {
 	name := s.opts.Image
 	_, err := reference.ParseNormalizedNamed(name)
 	if err != nil {
-		return false, err // invalid reference format
+		return "", false, err // invalid reference format
 	}
-	if !strings.Contains(name, ":") {
+	digested := strings.Contains(name, "@")
+	if !digested && !strings.Contains(name, ":") {
 		name = name + ":latest"
 	}
-	images, err := s.cli.ImageList(s.ctx, image.ListOptions{})
+	var images []image.Summary
+	err = s.retry.retry("ImageList", func() error {
+		var err error
+		images, err = s.cli.ImageList(s.ctx, image.ListOptions{})
+		return err
+	})
 	if err != nil {
-		return false, err
+		return "", false, err
 	}
 	for _, image := range images {
-		for _, tag := range image.RepoTags {
-			if tag == name {
-				return true, nil
+		refs := image.RepoTags
+		if digested {
+			refs = image.RepoDigests
+		}
+		for _, ref := range refs {
+			if ref == name {
+				return imageDigest(image), true, nil
 			}
 		}
 	}
-	return false, nil
+	return "", false, nil
+}
+
+func imageDigest(summary image.Summary) string {
+	for _, d := range summary.RepoDigests {
+		if i := strings.Index(d, "@"); i >= 0 {
+			return d[i+1:]
+		}
+	}
+	return summary.ID
 }
 
 func (s *Session) pullImage() error {
@@ -168,14 +269,22 @@ func (s *Session) pullImage() error {
 
 func (s *Session) createContainer() error {
 	resp, err := s.cli.ContainerCreate(s.ctx, &container.Config{
-		Image:      s.opts.Image,
-		Cmd:        []string{"sleep", strconv.Itoa(staleAgeLimitSeconds)},
-		WorkingDir: s.opts.WorkingDir,
-		User:       s.opts.User,
+		Image:           s.opts.Image,
+		Cmd:             []string{"sleep", strconv.Itoa(lifetime(s.opts))},
+		Labels:          map[string]string{lifetimeLabel: strconv.Itoa(lifetime(s.opts))},
+		NetworkDisabled: s.opts.NetworkDisabled,
+		WorkingDir:      s.opts.WorkingDir,
+		User:            s.opts.User,
 	}, &container.HostConfig{
-		AutoRemove: true,
+		AutoRemove:  true,
+		Mounts:      s.toMounts(),
+		NetworkMode: s.networkMode(),
+		Runtime:     s.opts.Runtime,
 		Resources: container.Resources{
-			PidsLimit: ptr.To(int64(100)),
+			CPUShares:  cpuShares[s.opts.Priority],
+			Memory:     s.opts.Memory,
+			MemorySwap: s.opts.Memory,
+			PidsLimit:  ptr.To(int64(100)),
 		},
 	}, nil, nil, "")
 	if err != nil {
@@ -185,91 +294,242 @@ func (s *Session) createContainer() error {
 	return nil
 }
 
+// cpuShares weighs a run's CPU time against others by priority; docker's
+// default is 1024.
+var cpuShares = map[string]int64{
+	PriorityLow:  512,
+	PriorityHigh: 2048,
+}
+
+func (s *Session) networkMode() container.NetworkMode {
+	if s.opts.NetworkDisabled {
+		return network.NetworkNone
+	}
+	return ""
+}
+
+func (s *Session) toMounts() []mount.Mount {
+	var mounts []mount.Mount
+	for _, m := range s.opts.Mounts {
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeVolume,
+			Source:   m.Volume,
+			Target:   m.Target,
+			ReadOnly: m.ReadOnly,
+		})
+	}
+	return mounts
+}
+
 func (s *Session) copyFiles() error {
-	tarBuffer := new(bytes.Buffer)
-	tarWriter := tar.NewWriter(tarBuffer)
+	if err := checkUploadSize(s.opts); err != nil {
+		return err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		_ = pw.CloseWithError(writeTar(pw, s.opts.Files))
+	}()
 	defer func() {
-		if err := tarWriter.Close(); err != nil {
-			log.Printf("failed to close tar writer: %v", err)
-		}
+		_ = pr.Close()
 	}()
+	return s.cli.CopyToContainer(s.ctx, s.id, "/", pr, container.CopyToContainerOptions{})
+}
 
-	for _, file := range s.opts.Files {
+func checkUploadSize(opts *Opts) error {
+	var total int64
+	for _, file := range opts.Files {
+		_, size := file.open()
+		total += size
+	}
+	if total > opts.MaxUploadBytes {
+		return apperror.ErrUploadTooLarge
+	}
+	return nil
+}
+
+func writeTar(w io.Writer, files []File) error {
+	tarWriter := tar.NewWriter(w)
+	for _, file := range files {
+		r, size := file.open()
 		hdr := &tar.Header{
 			Name: file.Name,
 			Mode: 0644,
-			Size: int64(len(file.Body)),
+			Size: size,
 		}
 		if err := tarWriter.WriteHeader(hdr); err != nil {
 			return err
 		}
-		if _, err := tarWriter.Write([]byte(file.Body)); err != nil {
+		if _, err := io.CopyN(tarWriter, r, size); err != nil {
 			return err
 		}
 	}
-	if err := tarWriter.Close(); err != nil {
+	return tarWriter.Close()
+}
+
+func (s *Session) execute() error {
+	if err := s.phase(PhaseStats, s.collectStatsStart); err != nil {
 		return err
 	}
+	limit := newOutputLimit(s.opts)
+	ctx, cancel := context.WithTimeout(s.ctx, time.Duration(s.opts.Timeout)*time.Millisecond)
+	defer cancel()
 
-	if err := s.cli.CopyToContainer(s.ctx, s.id, "/", tarBuffer, container.CopyToContainerOptions{}); err != nil {
-		return err
+	s.startTime = time.Now()
+	compiled := true
+	if s.opts.Compile != "" {
+		compileOpts := *s.opts
+		compileOpts.Base64Binary = false
+		stdout, stderr := newLogWriters(&s.result.Logs, &compileOpts, limit)
+		code, timedout, err := s.exec(ctx, []string{s.opts.Shell, "-c", s.opts.Compile}, "", false, nil, stdout, stderr)
+		if err != nil {
+			return err
+		}
+		stdout.Close()
+		stderr.Close()
+		s.result.CompileLogs = len(s.result.Logs)
+		s.result.Code, s.result.Timedout = code, timedout
+		compiled = code == 0 && !timedout
+	}
+	if compiled {
+		stdout, stderr := newLogWriters(&s.result.Logs, s.opts, limit)
+		code, timedout, err := s.exec(ctx, s.opts.argv(), "", s.opts.Tty, nil, stdout, stderr)
+		if err != nil {
+			return err
+		}
+		stdout.Close()
+		stderr.Close()
+		applyBase64(&s.result, stdout, stderr)
+		s.result.Code, s.result.Timedout = code, timedout
 	}
-	return nil
+	s.result.Time = int(time.Since(s.startTime).Milliseconds())
+	s.result.addPhase(PhaseExec, time.Since(s.startTime))
+	s.result.OutputTruncated = limit.wasTruncated()
+	return s.phase(PhaseStats, s.collectStatsEnd)
 }
 
-func (s *Session) execute() error {
+// exec runs argv in the container until it exits or ctx is done, and
+// returns its exit code. user, when set, overrides the container's user;
+// stdin, when set, is written to it and closed.
+func (s *Session) exec(ctx context.Context, argv []string, user string, tty bool, stdin io.Reader, stdout, stderr io.Writer) (int, bool, error) {
 	execOpts := container.ExecOptions{
+		AttachStdin:  stdin != nil,
 		AttachStdout: true,
 		AttachStderr: true,
-		Cmd:          []string{s.opts.Shell, "-c", s.opts.Command},
+		Cmd:          argv,
+		Env:          execEnv(s.opts),
+		Tty:          tty,
+		User:         user,
 	}
 	exec, err := s.cli.ContainerExecCreate(s.ctx, s.id, execOpts)
 	if err != nil {
-		return err
-	}
-	if err := s.collectStatsStart(); err != nil {
-		return err
+		return 0, false, err
 	}
 	attach, err := s.cli.ContainerExecAttach(s.ctx, exec.ID, container.ExecStartOptions{})
 	if err != nil {
-		return err
+		return 0, false, err
 	}
 	defer attach.Close()
 
-	stdout := &logWriter{stream: 1, logs: &s.result.Logs}
-	stderr := &logWriter{stream: 2, logs: &s.result.Logs}
-
-	ctx, cancel := context.WithTimeout(s.ctx, time.Duration(s.opts.Timeout)*time.Millisecond)
-	defer cancel()
-
-	s.startTime = time.Now()
+	if stdin != nil {
+		go func() {
+			// A program that exits without reading its input breaks the pipe.
+			_, _ = io.Copy(attach.Conn, stdin)
+			_ = attach.CloseWrite()
+		}()
+	}
 	done := make(chan error, 1)
 	go func() {
+		if tty {
+			// A tty merges both streams into one unframed stream.
+			_, err := io.Copy(stdout, attach.Reader)
+			done <- err
+			return
+		}
 		_, err := stdcopy.StdCopy(stdout, stderr, attach.Reader)
 		done <- err
 	}()
 
+	timedout := false
 	select {
 	case <-ctx.Done():
-		s.result.Timedout = true
+		timedout = true
 	case err := <-done:
+		if err != nil {
+			return 0, false, err
+		}
+	}
+	var resp container.ExecInspect
+	err = s.retry.retry("ContainerExecInspect", func() error {
+		var err error
+		resp, err = s.cli.ContainerExecInspect(s.ctx, exec.ID)
+		return err
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	return resp.ExitCode, timedout, nil
+}
+
+// runSteps runs the steps of a run whose command succeeded. A step's memory
+// is set on the container before it starts, and a step without one goes back
+// to the run's. An update cannot remove a limit, so no limit is the host's
+// memory.
+func (s *Session) runSteps() error {
+	if len(s.opts.Steps) == 0 || s.result.Code != 0 || s.result.Timedout {
+		return nil
+	}
+	memory := s.opts.Memory
+	for _, step := range s.opts.Steps {
+		if m := stepMemory(step, s.opts); m != memory {
+			if err := s.updateMemory(m); err != nil {
+				return err
+			}
+			memory = m
+		}
+		ctx, cancel := context.WithTimeout(s.ctx, time.Duration(stepTimeout(step, s.opts))*time.Millisecond)
+		limit := newOutputLimit(s.opts)
+		stdout, stderr := &stepWriter{limit: limit}, &stepWriter{limit: limit}
+		start := time.Now()
+		code, timedout, err := s.exec(ctx, step.Args, step.User, false, strings.NewReader(step.Stdin), stdout, stderr)
+		cancel()
 		if err != nil {
 			return err
 		}
+		s.result.Steps = append(s.result.Steps, StepResult{
+			Stdout:   stdout.buf.String(),
+			Stderr:   stderr.buf.String(),
+			Code:     code,
+			Time:     int(time.Since(start).Milliseconds()),
+			Timedout: timedout,
+		})
 	}
+	return nil
+}
 
-	s.result.Time = int(time.Since(s.startTime).Milliseconds())
-	stdout.Close()
-	stderr.Close()
-	if err := s.collectStatsEnd(); err != nil {
-		return err
+func (s *Session) updateMemory(memory int64) error {
+	if memory == 0 {
+		err := s.retry.retry("Info", func() error {
+			info, err := s.cli.Info(s.ctx)
+			memory = info.MemTotal
+			return err
+		})
+		if err != nil {
+			return err
+		}
 	}
-	resp, err := s.cli.ContainerExecInspect(s.ctx, exec.ID)
-	if err != nil {
+	return s.retry.retry("ContainerUpdate", func() error {
+		_, err := s.cli.ContainerUpdate(s.ctx, s.id, container.UpdateConfig{
+			Resources: container.Resources{Memory: memory, MemorySwap: memory},
+		})
 		return err
+	})
+}
+
+func execEnv(opts *Opts) []string {
+	if !opts.Tty {
+		return opts.Env
 	}
-	s.result.Code = resp.ExitCode
-	return nil
+	return append([]string{"TERM=xterm-256color"}, opts.Env...)
 }
 
 func (s *Session) collectStatsStart() error {
@@ -298,7 +558,12 @@ func (s *Session) collectStatsEnd() error {
 }
 
 func (s *Session) getStats() (int, int, error) {
-	stats, err := s.cli.ContainerStatsOneShot(s.ctx, s.id)
+	var stats container.StatsResponseReader
+	err := s.retry.retry("ContainerStatsOneShot", func() error {
+		var err error
+		stats, err = s.cli.ContainerStatsOneShot(s.ctx, s.id)
+		return err
+	})
 	if err != nil {
 		return 0, 0, err
 	}
@@ -318,10 +583,15 @@ func (s *Session) getStats() (int, int, error) {
 }
 
 func (s *Session) collectImages() error {
-	if !s.opts.CollectImages {
+	if !s.opts.CollectImages && len(s.opts.Artifacts) == 0 {
 		return nil
 	}
-	reader, _, err := s.cli.CopyFromContainer(s.ctx, s.id, s.opts.WorkingDir)
+	var reader io.ReadCloser
+	err := s.retry.retry("CopyFromContainer", func() error {
+		var err error
+		reader, _, err = s.cli.CopyFromContainer(s.ctx, s.id, s.opts.WorkingDir)
+		return err
+	})
 	if err != nil {
 		return err
 	}
@@ -331,9 +601,8 @@ func (s *Session) collectImages() error {
 		}
 	}()
 
+	c := &collector{opts: s.opts}
 	tr := tar.NewReader(reader)
-	maxFileSize := 100 * 1024 // 100KiB
-
 	for {
 		header, err := tr.Next()
 		if err == io.EOF {
@@ -342,17 +611,15 @@ func (s *Session) collectImages() error {
 		if err != nil {
 			return err
 		}
-		if !header.FileInfo().IsDir() && filepath.Ext(header.Name) == ".png" && header.Size <= int64(maxFileSize) {
-			var fileContent bytes.Buffer
-			if _, err := io.Copy(&fileContent, tr); err != nil {
-				return err
-			}
-			encoded := base64.StdEncoding.EncodeToString(fileContent.Bytes())
-			s.result.Images = append(s.result.Images, encoded)
-			if len(s.result.Images) >= s.opts.CollectImagesCount {
-				break
-			}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		// Entries start with the base name of the working directory.
+		_, name, _ := strings.Cut(header.Name, "/")
+		if err := c.add(name, header.Size, tr); err != nil {
+			return err
 		}
 	}
+	c.finish(&s.result)
 	return nil
 }
@@ -0,0 +1,68 @@
+package box
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/image"
+	"github.com/stretchr/testify/require"
+	"github.com/zetaoss/runbox/pkg/apperror"
+)
+
+func TestWriteTar(t *testing.T) {
+	files := []File{
+		{Name: "/tmp/a.txt", Body: "hello"},
+		{Name: "/tmp/b.csv", Reader: strings.NewReader("x,y\n1,2\n"), Size: 8},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, writeTar(&buf, files))
+
+	got := map[string]string{}
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		body, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		got[hdr.Name] = string(body)
+	}
+	require.Equal(t, map[string]string{"/tmp/a.txt": "hello", "/tmp/b.csv": "x,y\n1,2\n"}, got)
+
+	short := []File{{Name: "/tmp/c", Reader: strings.NewReader("abc"), Size: 10}}
+	require.ErrorIs(t, writeTar(io.Discard, short), io.EOF)
+}
+
+func TestCheckUploadSize(t *testing.T) {
+	opts := &Opts{
+		MaxUploadBytes: 10,
+		Files: []File{
+			{Name: "a", Body: "12345"},
+			{Name: "b", Reader: strings.NewReader(""), Size: 5},
+		},
+	}
+	require.NoError(t, checkUploadSize(opts))
+	opts.MaxUploadBytes = 9
+	require.Equal(t, apperror.ErrUploadTooLarge, checkUploadSize(opts))
+}
+
+func TestImageDigest(t *testing.T) {
+	require.Equal(t, "sha256:abc", imageDigest(image.Summary{ID: "sha256:def", RepoDigests: []string{"ghcr.io/zetaoss/runcontainers/python@sha256:abc"}}))
+	require.Equal(t, "sha256:def", imageDigest(image.Summary{ID: "sha256:def"}))
+}
+
+func TestLifetime(t *testing.T) {
+	require.Equal(t, 300, lifetime(&Opts{Timeout: 60000}))
+	require.Equal(t, 660, lifetime(&Opts{Timeout: 600000}))
+	steps := make([]Step, 100)
+	for i := range steps {
+		steps[i].Timeout = 61000
+	}
+	require.Equal(t, 6170, lifetime(&Opts{Timeout: 10000, Steps: steps}))
+	require.Equal(t, 300, lifetime(&Opts{Timeout: 10000, Steps: []Step{{}, {}}}))
+}
@@ -1,37 +1,159 @@
 package box
 
 import (
+	"bytes"
+	"io"
 	"strings"
+	"sync"
+	"time"
 )
 
 type Opts struct {
+	Args                  []string // run as is with no shell, in place of Command
+	Artifacts             []string // files relative to WorkingDir returned after the run
+	Base64Binary          bool     // base64 encode output that is not valid text
 	CollectStats          *bool
 	CollectImages         bool
 	CollectImagesCount    int
 	Command               string
+	Compile               string // runs before Command, which only runs if it succeeds
 	Env                   []string
 	Files                 []File
 	Image                 string
+	MaxArtifactBytes      int64
+	MaxImageBytes         int64
+	MaxImagesBytes        int64 // total of all images, 0 for no limit
+	MaxOutputBytes        int64 // stdout and stderr together, 0 for no limit
+	MaxUploadBytes        int64
+	Memory                int64 // bytes, 0 for no limit
+	Mounts                []Mount
+	NetworkDisabled       bool
+	OnLog                 func(Log) // called with each complete line of output
+	OutputEncoding        string    // charset output is decoded from
+	Priority              string
 	PullImageIfNotPresent *bool
+	Runtime               string
 	Shell                 string
+	Steps                 []Step // run one by one after Command succeeds, apart from Logs
 	Timeout               int
+	Tty                   bool
 	User                  string
 	WorkingDir            string
 }
 
+// argv is the process a run executes: Args, or Command through Shell.
+func (o *Opts) argv() []string {
+	if len(o.Args) > 0 {
+		return o.Args
+	}
+	return []string{o.Shell, "-c", o.Command}
+}
+
 type Result struct {
-	Logs     []Log    `json:"logs,omitempty"`
-	Code     int      `json:"code,omitempty"`
-	CPU      int      `json:"cpu,omitempty"`
-	MEM      int      `json:"mem,omitempty"`
-	Time     int      `json:"time,omitempty"`
-	Timedout bool     `json:"timedout,omitempty"`
-	Images   []string `json:"images,omitempty"`
+	Logs     []Log `json:"logs,omitempty"`
+	Code     int   `json:"code,omitempty"`
+	CPU      int   `json:"cpu,omitempty"`
+	MEM      int   `json:"mem,omitempty"`
+	Time     int   `json:"time,omitempty"`
+	Timedout bool  `json:"timedout,omitempty"`
+	// OutputTruncated is set when output past MaxOutputBytes was dropped.
+	OutputTruncated bool     `json:"outputTruncated,omitempty"`
+	Images          []string `json:"images,omitempty"`
+	Runtime         string   `json:"runtime,omitempty"`
+	// CompileLogs counts the lines at the start of Logs written by Compile.
+	CompileLogs int `json:"-"`
+	// Steps holds the results of the steps that ran, in order.
+	Steps []StepResult `json:"steps,omitempty"`
+
+	// ImageFormats gives the format, png or svg, of each image when any
+	// is not a PNG.
+	ImageFormats []string `json:"imageFormats,omitempty"`
+	// SkippedImages counts images left out for their size or the count.
+	SkippedImages int        `json:"skippedImages,omitempty"`
+	Artifacts     []Artifact `json:"artifacts,omitempty"`
+
+	// ImageDigest identifies the exact image the run used.
+	ImageDigest string `json:"imageDigest,omitempty"`
+
+	StdoutBase64 string `json:"stdoutBase64,omitempty"`
+	StderrBase64 string `json:"stderrBase64,omitempty"`
+
+	// Phases holds the milliseconds spent in each phase of the run.
+	Phases map[string]int `json:"phases,omitempty"`
+}
+
+const (
+	PhasePrune           = "prune"
+	PhaseCheckImage      = "checkImage"
+	PhasePullImage       = "pullImage"
+	PhaseCreateContainer = "createContainer"
+	PhaseCopyFiles       = "copyFiles"
+	PhaseContainerStart  = "containerStart"
+	PhaseExec            = "exec"
+	PhaseStats           = "stats"
+	PhaseCollectImages   = "collectImages"
+	PhaseContainerRemove = "containerRemove"
+	PhaseWriteFiles      = "writeFiles"
+	PhaseStart           = "start"
+	PhaseSteps           = "steps"
+)
+
+func (r *Result) addPhase(name string, d time.Duration) {
+	if r.Phases == nil {
+		r.Phases = map[string]int{}
+	}
+	r.Phases[name] += int(d.Milliseconds())
+}
+
+// Step is a process run after the command. Timeout, Memory and, on docker,
+// User default to the run's.
+type Step struct {
+	Args    []string
+	Stdin   string
+	Timeout int   // ms
+	Memory  int64 // bytes
+	User    string
+}
+
+type StepResult struct {
+	Stdout   string `json:"stdout,omitempty"`
+	Stderr   string `json:"stderr,omitempty"`
+	Code     int    `json:"code,omitempty"`
+	Time     int    `json:"time"`
+	Timedout bool   `json:"timedout,omitempty"`
+}
+
+// stepWriter keeps what a step writes to one stream, up to the limit.
+type stepWriter struct {
+	buf   bytes.Buffer
+	limit *outputLimit
+}
+
+func (w *stepWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	w.buf.Write(w.limit.take(p))
+	return n, nil
 }
 
 type File struct {
 	Name string `json:"name"`
 	Body string `json:"body"`
+	// Reader, when set, is streamed instead of Body and must yield exactly Size bytes.
+	Reader io.Reader `json:"-"`
+	Size   int64     `json:"-"`
+}
+
+func (f File) open() (io.Reader, int64) {
+	if f.Reader != nil {
+		return f.Reader, f.Size
+	}
+	return strings.NewReader(f.Body), int64(len(f.Body))
+}
+
+type Mount struct {
+	Volume   string
+	Target   string
+	ReadOnly bool
 }
 
 type Log struct {
@@ -40,36 +162,76 @@ type Log struct {
 }
 
 type logWriter struct {
-	stream int
-	logs   *[]Log
-	buffer string
+	stream   int
+	logs     *[]Log
+	buffer   []byte
+	encoding string
+	raw      *bytes.Buffer
+	limit    *outputLimit
+	onLog    func(Log)
+	// mu guards logs and onLog, which the writers of a run share.
+	mu *sync.Mutex
 }
 
-func (w *logWriter) Write(p []byte) (n int, err error) {
-	w.buffer += string(p)
-	lines := strings.Split(w.buffer, "\n")
+func newLogWriter(stream int, logs *[]Log, opts *Opts, limit *outputLimit) *logWriter {
+	w := &logWriter{
+		stream:   stream,
+		logs:     logs,
+		encoding: opts.OutputEncoding,
+		limit:    limit,
+		onLog:    opts.OnLog,
+		mu:       new(sync.Mutex),
+	}
+	if opts.Base64Binary {
+		w.raw = new(bytes.Buffer)
+	}
+	return w
+}
 
-	w.buffer = lines[len(lines)-1]
-	lines = lines[:len(lines)-1]
+// newLogWriters returns the stdout and stderr writers of a run. They may be
+// written from different goroutines.
+func newLogWriters(logs *[]Log, opts *Opts, limit *outputLimit) (*logWriter, *logWriter) {
+	stdout := newLogWriter(1, logs, opts, limit)
+	stderr := newLogWriter(2, logs, opts, limit)
+	stderr.mu = stdout.mu
+	return stdout, stderr
+}
 
-	for _, line := range lines {
-		log := Log{
-			Stream: w.stream,
-			Log:    strings.TrimRight(line, "\n"),
+func (w *logWriter) Write(p []byte) (n int, err error) {
+	n = len(p)
+	p = w.limit.take(p)
+	if w.raw != nil {
+		w.raw.Write(p)
+	}
+	w.buffer = append(w.buffer, p...)
+	for {
+		i := bytes.IndexByte(w.buffer, '\n')
+		if i < 0 {
+			break
 		}
-		*w.logs = append(*w.logs, log)
+		w.appendLog(w.buffer[:i])
+		w.buffer = w.buffer[i+1:]
+	}
+	return n, nil
+}
+
+func (w *logWriter) appendLog(line []byte) {
+	l := Log{
+		Stream: w.stream,
+		Log:    decodeLine(line, w.encoding),
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	*w.logs = append(*w.logs, l)
+	if w.onLog != nil {
+		w.onLog(l)
 	}
-	return len(p), nil
 }
 
 func (w *logWriter) Close() {
-	if w.buffer != "" {
-		log := Log{
-			Stream: w.stream,
-			Log:    w.buffer,
-		}
-		*w.logs = append(*w.logs, log)
-		w.buffer = ""
+	if len(w.buffer) > 0 {
+		w.appendLog(w.buffer)
+		w.buffer = nil
 	}
 }
 
@@ -3,7 +3,11 @@ package browse
 import (
 	"errors"
 	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
 
+	"github.com/zetaoss/runbox/pkg/apperror"
 	"github.com/zetaoss/runbox/pkg/runner/box"
 	"k8s.io/utils/ptr"
 )
@@ -16,15 +20,41 @@ func New(box *box.Box) *Browse {
 	return &Browse{box}
 }
 
-func (b *Browse) Run(urlString string) (string, error) {
+// chromeArgs runs chrome on the URL without a shell. "--" ends chrome's
+// switches, so the URL is never read as one.
+func chromeArgs(urlString string) ([]string, error) {
+	if strings.IndexFunc(urlString, unicode.IsSpace) >= 0 || strings.IndexFunc(urlString, unicode.IsControl) >= 0 {
+		return nil, fmt.Errorf("%w: has a space or control character", apperror.ErrInvalidURL)
+	}
+	u, err := url.Parse(urlString)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", apperror.ErrInvalidURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("%w: only http and https urls are allowed", apperror.ErrInvalidURL)
+	}
+	return []string{"/opt/google/chrome/chrome", "--headless", "--dump-dom", "--disable-gpu", "--no-sandbox", "--", u.String()}, nil
+}
+
+func (b *Browse) Run(urlString string, runOpts box.RunOptions) (string, error) {
 	image := "selenium/standalone-chrome:3.141.59"
-	command := fmt.Sprintf(`/opt/google/chrome/chrome --headless --dump-dom --disable-gpu --no-sandbox '%s'`, urlString)
+	args, err := chromeArgs(urlString)
+	if err != nil {
+		return "", err
+	}
 	opts := &box.Opts{
+		Args:         args,
 		CollectStats: ptr.To(false),
-		Command:      command,
 		Image:        image,
 		Timeout:      30000,
 	}
+	// Fetching the page is the point, so the run asks for a network.
+	if runOpts.Network == nil {
+		runOpts.Network = ptr.To(true)
+	}
+	if err := runOpts.Apply(opts, b.box.Limits()); err != nil {
+		return "", err
+	}
 	result, err := b.box.Run(opts)
 	if err != nil {
 		return "", fmt.Errorf("box.Run err: %w", err)
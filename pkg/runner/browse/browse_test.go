@@ -31,7 +31,36 @@ func TestRun(t *testing.T) {
 	}
 	for i, tc := range testCases {
 		t.Run(testutil.Name(i, tc.urlString), func(t *testing.T) {
-			got, err := browse1.Run(tc.urlString)
+			got, err := browse1.Run(tc.urlString, box.RunOptions{})
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestChromeArgs(t *testing.T) {
+	testCases := []struct {
+		urlString string
+		want      []string
+		wantError string
+	}{
+		{"https://example.com/a?b=c&d=e", []string{"/opt/google/chrome/chrome", "--headless", "--dump-dom", "--disable-gpu", "--no-sandbox", "--", "https://example.com/a?b=c&d=e"}, ""},
+		{"https://example.com/';touch${IFS}x;'", []string{"/opt/google/chrome/chrome", "--headless", "--dump-dom", "--disable-gpu", "--no-sandbox", "--", "https://example.com/%27;touch$%7BIFS%7Dx;%27"}, ""},
+		{"http://example.com/$(id)`id`", []string{"/opt/google/chrome/chrome", "--headless", "--dump-dom", "--disable-gpu", "--no-sandbox", "--", "http://example.com/$%28id%29%60id%60"}, ""},
+		{"https://example.com/' && rm -rf / '", nil, "invalid url: has a space or control character"},
+		{"https://example.com/\nid", nil, "invalid url: has a space or control character"},
+		{"--user-data-dir=/tmp", nil, "invalid url: only http and https urls are allowed"},
+		{"file:///etc/passwd", nil, "invalid url: only http and https urls are allowed"},
+		{"javascript:alert(1)", nil, "invalid url: only http and https urls are allowed"},
+		{"https://", nil, "invalid url: only http and https urls are allowed"},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.urlString), func(t *testing.T) {
+			got, err := chromeArgs(tc.urlString)
+			if tc.wantError != "" {
+				require.EqualError(t, err, tc.wantError)
+				return
+			}
 			require.NoError(t, err)
 			require.Equal(t, tc.want, got)
 		})
@@ -0,0 +1,110 @@
+package lang
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/zetaoss/runbox/pkg/apperror"
+)
+
+// Commands in the registry mark where arguments go with these placeholders.
+const (
+	argsCompile = "compileArgs"
+	argsRuntime = "runtimeArgs"
+	argsRun     = "runArgs"
+)
+
+const (
+	maxArgs      = 32
+	maxArgLength = 256
+)
+
+type AllowedArgs struct {
+	Compile []string `yaml:"compile,omitempty" json:"compile,omitempty"`
+	Runtime []string `yaml:"runtime,omitempty" json:"runtime,omitempty"`
+}
+
+func compileAllowed(patterns []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, p := range patterns {
+		re, err := regexp.Compile("^(?:" + p + ")$")
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func placeholder(name string) string {
+	return "{{" + name + "}}"
+}
+
+// checkArgs validates user arguments of one kind. Compiler and runtime flags
+// must match the language allowlist; program arguments may be anything since
+// they are quoted, but the command must have a place for them.
+func (s Spec) checkArgs(name string, args []string, allowed []*regexp.Regexp) error {
+	if len(args) == 0 {
+		return nil
+	}
+	if len(args) > maxArgs {
+		return fmt.Errorf("%w: too many %s", apperror.ErrInvalidArgs, name)
+	}
+	p := placeholder(name)
+	if !strings.Contains(s.Command, p) && !strings.Contains(s.Compile, p) && !strings.Contains(s.Run, p) {
+		return fmt.Errorf("%w: %s not supported for %s", apperror.ErrInvalidArgs, name, s.Name)
+	}
+	for _, arg := range args {
+		if len(arg) > maxArgLength || strings.ContainsRune(arg, 0) {
+			return fmt.Errorf("%w: %s '%s'", apperror.ErrInvalidArgs, name, arg)
+		}
+		if name == argsRun {
+			continue
+		}
+		ok := false
+		for _, re := range allowed {
+			if re.MatchString(arg) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("%w: %s '%s'", apperror.ErrInvalidArgs, name, arg)
+		}
+	}
+	return nil
+}
+
+// expandArgs replaces a placeholder with the shell-quoted arguments, dropping
+// it together with its leading space when there are none.
+func expandArgs(command, name string, args []string) string {
+	return strings.NewReplacer(argsReplacements(name, args)...).Replace(command)
+}
+
+// argsReplacements are the strings.NewReplacer pairs of expandArgs.
+func argsReplacements(name string, args []string) []string {
+	p := placeholder(name)
+	if len(args) == 0 {
+		return []string{" " + p, "", p, ""}
+	}
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return []string{p, strings.Join(quoted, " ")}
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// expand fills in every placeholder in one pass, so that nothing it puts in
+// is expanded again.
+func (s Spec) expand(command string, input Input, entry string) string {
+	replacements := entryReplacements(s.FileDir, entry)
+	replacements = append(replacements, argsReplacements(argsCompile, input.CompileArgs)...)
+	replacements = append(replacements, argsReplacements(argsRuntime, input.RuntimeArgs)...)
+	replacements = append(replacements, argsReplacements(argsRun, input.RunArgs)...)
+	return strings.NewReplacer(replacements...).Replace(command)
+}
@@ -0,0 +1,102 @@
+package lang
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zetaoss/runbox/pkg/runner/box"
+	"github.com/zetaoss/runbox/pkg/testutil"
+)
+
+func TestArgs(t *testing.T) {
+	r := Builtin()
+	files := []box.File{{Body: "x"}}
+	testCases := []struct {
+		input       Input
+		wantCommand string
+		wantError   string
+	}{
+		{
+			Input{Lang: "c", Files: files},
+			"gcc runbox.c; ./a.out",
+			"",
+		},
+		{
+			Input{Lang: "c", Files: files, CompileArgs: []string{"-O2", "-std=c17", "-Wall", "-lm"}, RunArgs: []string{"a b", "it's"}},
+			`gcc runbox.c '-O2' '-std=c17' '-Wall' '-lm'; ./a.out 'a b' 'it'\''s'`,
+			"",
+		},
+		{
+			Input{Lang: "cpp", Files: files, CompileArgs: []string{"-std=c++20"}},
+			"g++ runbox.cpp '-std=c++20'; ./a.out",
+			"",
+		},
+		{
+			Input{Lang: "java", Files: files, RuntimeArgs: []string{"-Xmx256m"}, RunArgs: []string{"$(id)"}},
+			`javac -d bin -cp "lib/*:/cache/java/lib/*" $(find src -name '*.java'); java '-Xmx256m' -cp "bin:lib/*:/cache/java/lib/*" App '$(id)'`,
+			"",
+		},
+		{
+			Input{Lang: "python", Files: files, RuntimeArgs: []string{"-O"}, RunArgs: []string{"--flag"}},
+			"python '-O' runbox.py '--flag'",
+			"",
+		},
+		{
+			Input{Lang: "python", Files: []box.File{{Name: "{{runArgs}}.py", Body: "x"}}, Entry: "{{runArgs}}.py", RunArgs: []string{"{{main}}"}},
+			`python '{{runArgs}}.py' '{{main}}'`,
+			"",
+		},
+		{
+			Input{Lang: "c", Files: files, CompileArgs: []string{"-Wl,-T,/etc/passwd"}},
+			"",
+			"invalid args: compileArgs '-Wl,-T,/etc/passwd'",
+		},
+		{
+			Input{Lang: "c", Files: files, CompileArgs: []string{"-O2; rm -rf /"}},
+			"",
+			"invalid args: compileArgs '-O2; rm -rf /'",
+		},
+		{
+			Input{Lang: "python", Files: files, RuntimeArgs: []string{"-c", "print(1)"}},
+			"",
+			"invalid args: runtimeArgs '-c'",
+		},
+		{
+			Input{Lang: "c", Files: files, RuntimeArgs: []string{"-X"}},
+			"",
+			"invalid args: runtimeArgs not supported for c",
+		},
+		{
+			Input{Lang: "sqlite3", Files: files, RunArgs: []string{"x"}},
+			"",
+			"invalid args: runArgs not supported for sqlite3",
+		},
+		{
+			Input{Lang: "bash", Files: files, RunArgs: make([]string, 33)},
+			"",
+			"invalid args: too many runArgs",
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.input.Lang), func(t *testing.T) {
+			got, err := toLangOpts(r, tc.input)
+			if tc.wantError != "" {
+				require.EqualError(t, err, tc.wantError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.wantCommand, got.Command)
+		})
+	}
+}
+
+func TestArgs_judge(t *testing.T) {
+	got, err := toLangOpts(Builtin(), Input{Lang: "go", Files: []box.File{{Body: "x"}}, CompileArgs: []string{"-race"}, RunArgs: []string{"1"}})
+	require.NoError(t, err)
+	require.Equal(t, "go mod tidy > /dev/null 2>&1; go build '-race' -o runbox.bin runbox.go", got.Compile)
+	require.Equal(t, "./runbox.bin '1'", got.Run)
+}
+
+func TestShellQuote(t *testing.T) {
+	require.Equal(t, `'echo '\''hi'\'''`, shellQuote("echo 'hi'"))
+}
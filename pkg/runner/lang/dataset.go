@@ -0,0 +1,200 @@
+package lang
+
+import (
+	"encoding/csv"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zetaoss/runbox/pkg/apperror"
+)
+
+const (
+	// sqliteDatabase is the per-run copy of the dataset sqlite3 opens.
+	sqliteDatabase = "/tmp/runbox.db"
+	seedFileName   = ".runbox-seed.sql"
+	csvInsertBatch = 500
+)
+
+var identPattern = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// applyDataset starts a SQL language from a pristine copy of the chosen
+// dataset and imports the request's CSV and SQL files before its query.
+func (s Spec) applyDataset(opts *LangOpts) error {
+	input := opts.Input
+	if len(s.Datasets) == 0 {
+		if input.Dataset != "" || len(input.Imports) > 0 {
+			return fmt.Errorf("%w: datasets not supported for %s", apperror.ErrInvalidDataset, s.Name)
+		}
+		return nil
+	}
+	name := input.Dataset
+	if name == "" {
+		name = s.DefaultDataset
+	}
+	src, ok := s.Datasets[name]
+	if name != "" && !ok {
+		return fmt.Errorf("%w: unknown dataset '%s'", apperror.ErrInvalidDataset, name)
+	}
+	seed, err := s.importSQL(input, path.Join(opts.WorkingDir, opts.FileDir))
+	if err != nil {
+		return err
+	}
+	switch s.SQL.Dialect {
+	case dialectSQLite3:
+		prepare := "cp " + shellWord(src) + " " + sqliteDatabase
+		if src == "" {
+			prepare = ": > " + sqliteDatabase
+		}
+		if seed != "" {
+			prepare += " && sqlite3 -bail " + sqliteDatabase + " < " + seedFileName
+			addDefaultFile(opts, seedFileName, seed)
+		}
+		opts.Prepare = prepare + " && "
+	case dialectMySQL:
+		prelude := ""
+		if name != "" {
+			prelude = "CREATE DATABASE runbox;\nUSE runbox;\n"
+			if src != "" {
+				prelude += "SOURCE " + src + "\n"
+			}
+		}
+		if prelude += seed; prelude != "" {
+			opts.ModifyMainFunc = func(source string) string {
+				return prelude + source
+			}
+		}
+	}
+	return nil
+}
+
+// importSQL turns the request's imports, in order, into SQL: SQL files are
+// read as they are and CSV files become a table named after the file.
+func (s Spec) importSQL(input Input, dir string) (string, error) {
+	var b strings.Builder
+	for _, name := range input.Imports {
+		if !plainWordPattern.MatchString(name) || name == s.mainName() {
+			return "", fmt.Errorf("%w: cannot import '%s'", apperror.ErrInvalidDataset, name)
+		}
+		var body string
+		found := false
+		for _, f := range input.Files {
+			if f.Name == name {
+				body, found = f.Body, true
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("%w: no file '%s'", apperror.ErrInvalidDataset, name)
+		}
+		switch strings.ToLower(path.Ext(name)) {
+		case ".sql":
+			if s.SQL.Dialect == dialectMySQL {
+				b.WriteString("SOURCE " + path.Join(dir, name) + "\n")
+			} else {
+				b.WriteString(".read " + path.Join(dir, name) + "\n")
+			}
+		case ".csv":
+			sql, err := csvSQL(name, body, s.SQL.Dialect)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(sql)
+		default:
+			return "", fmt.Errorf("%w: import '%s' is not .csv or .sql", apperror.ErrInvalidDataset, name)
+		}
+	}
+	return b.String(), nil
+}
+
+// csvSQL creates a table from a CSV file with a header row. Columns whose
+// values are all integers or all numbers get a numeric type.
+func csvSQL(name, body, dialect string) (string, error) {
+	records, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %s", apperror.ErrInvalidDataset, name, err)
+	}
+	if len(records) == 0 {
+		return "", fmt.Errorf("%w: %s: no header", apperror.ErrInvalidDataset, name)
+	}
+	header, rows := records[0], records[1:]
+	kinds := make([]int, len(header)) // 0 integer, 1 real, 2 text
+	for _, row := range rows {
+		for j, v := range row {
+			switch {
+			case v == "" || kinds[j] == 2:
+			case isInteger(v):
+			case isNumber(v):
+				kinds[j] = max(kinds[j], 1)
+			default:
+				kinds[j] = 2
+			}
+		}
+	}
+	types := []string{"INTEGER", "REAL", "TEXT"}
+	if dialect == dialectMySQL {
+		types = []string{"BIGINT", "DOUBLE", "TEXT"}
+	}
+	columns := make([]string, len(header))
+	for j, h := range header {
+		columns[j] = quoteIdent(sanitizeIdent(h), dialect) + " " + types[kinds[j]]
+	}
+	table := quoteIdent(sanitizeIdent(strings.TrimSuffix(path.Base(name), path.Ext(name))), dialect)
+	var b strings.Builder
+	fmt.Fprintf(&b, "CREATE TABLE %s (%s);\n", table, strings.Join(columns, ", "))
+	for start := 0; start < len(rows); start += csvInsertBatch {
+		batch := rows[start:min(start+csvInsertBatch, len(rows))]
+		values := make([]string, len(batch))
+		for i, row := range batch {
+			vs := make([]string, len(row))
+			for j, v := range row {
+				switch {
+				case v == "" && kinds[j] < 2:
+					vs[j] = "NULL"
+				case kinds[j] < 2:
+					vs[j] = v
+				default:
+					vs[j] = quoteString(v, dialect)
+				}
+			}
+			values[i] = "(" + strings.Join(vs, ", ") + ")"
+		}
+		fmt.Fprintf(&b, "INSERT INTO %s VALUES\n%s;\n", table, strings.Join(values, ",\n"))
+	}
+	return b.String(), nil
+}
+
+func isInteger(v string) bool {
+	_, err := strconv.ParseInt(v, 10, 64)
+	return err == nil
+}
+
+func isNumber(v string) bool {
+	// ParseFloat also takes hex, Inf and NaN, which SQL does not.
+	_, err := strconv.ParseFloat(v, 64)
+	return err == nil && !strings.ContainsAny(v, "xXnN")
+}
+
+func sanitizeIdent(s string) string {
+	s = identPattern.ReplaceAllString(strings.TrimSpace(s), "_")
+	if s == "" || s[0] >= '0' && s[0] <= '9' {
+		s = "_" + s
+	}
+	return s
+}
+
+func quoteIdent(s, dialect string) string {
+	if dialect == dialectMySQL {
+		return "`" + s + "`"
+	}
+	return `"` + s + `"`
+}
+
+func quoteString(s, dialect string) string {
+	if dialect == dialectMySQL {
+		s = strings.ReplaceAll(s, `\`, `\\`)
+	}
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,115 @@
+package lang
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zetaoss/runbox/pkg/runner/box"
+	"github.com/zetaoss/runbox/pkg/testutil"
+)
+
+func TestCSVSQL(t *testing.T) {
+	testCases := []struct {
+		name      string
+		body      string
+		dialect   string
+		want      string
+		wantError string
+	}{
+		{
+			"people.csv", "id,name,score\n1,Ann,9.5\n2,O'Neil,\n", dialectSQLite3,
+			"CREATE TABLE \"people\" (\"id\" INTEGER, \"name\" TEXT, \"score\" REAL);\n" +
+				"INSERT INTO \"people\" VALUES\n(1, 'Ann', 9.5),\n(2, 'O''Neil', NULL);\n",
+			"",
+		},
+		{
+			"2024 sales.csv", "first name,total\nA\\B,0x10\n", dialectMySQL,
+			"CREATE TABLE `_2024_sales` (`first_name` TEXT, `total` TEXT);\n" +
+				"INSERT INTO `_2024_sales` VALUES\n('A\\\\B', '0x10');\n",
+			"",
+		},
+		{"empty.csv", "a,b\n", dialectSQLite3, "CREATE TABLE \"empty\" (\"a\" INTEGER, \"b\" INTEGER);\n", ""},
+		{"bad.csv", "a,b\n1\n", dialectSQLite3, "", "invalid dataset: bad.csv: record on line 2: wrong number of fields"},
+		{"none.csv", "", dialectSQLite3, "", "invalid dataset: none.csv: no header"},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.name), func(t *testing.T) {
+			got, err := csvSQL(tc.name, tc.body, tc.dialect)
+			if tc.wantError != "" {
+				require.EqualError(t, err, tc.wantError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestDataset(t *testing.T) {
+	r := Builtin()
+	testCases := []struct {
+		input       Input
+		wantCommand string
+		wantMain    string
+		wantError   string
+	}{
+		{
+			Input{Lang: "sqlite3", Files: []box.File{{Body: "SELECT 1;"}}},
+			"cp chinook.db /tmp/runbox.db && sqlite3 -header /tmp/runbox.db < runbox.sql",
+			"SELECT 1;", "",
+		},
+		{
+			Input{Lang: "sqlite3", Files: []box.File{{Name: "t.csv", Body: "a\n1\n"}, {Name: "s.sql"}, {Body: "SELECT 1;"}}, Main: 2, Dataset: "empty", Imports: []string{"t.csv", "s.sql"}},
+			": > /tmp/runbox.db && sqlite3 -bail /tmp/runbox.db < .runbox-seed.sql && sqlite3 -header /tmp/runbox.db < runbox.sql",
+			"SELECT 1;", "",
+		},
+		{
+			Input{Lang: "sqlite3", Files: []box.File{{Body: ".tables"}}, Dataset: "sakila"},
+			"cp /opt/datasets/sakila.db /tmp/runbox.db && sqlite3 /tmp/runbox.db < runbox.sql",
+			".tables", "",
+		},
+		{
+			Input{Lang: "mysql", Files: []box.File{{Body: "SELECT 1;"}}},
+			"bash /tmp/entrypoint.sh",
+			"SELECT 1;", "",
+		},
+		{
+			Input{Lang: "mysql", Files: []box.File{{Name: "s.sql"}, {Body: "SELECT 1;"}}, Main: 1, Dataset: "northwind", Imports: []string{"s.sql"}},
+			"bash /tmp/entrypoint.sh",
+			"CREATE DATABASE runbox;\nUSE runbox;\nSOURCE /opt/datasets/northwind.sql\nSOURCE /home/user01/s.sql\nSELECT 1;", "",
+		},
+		{
+			Input{Lang: "sqlite3", Files: []box.File{{Body: "x"}}, Dataset: "nope"},
+			"", "", "invalid dataset: unknown dataset 'nope'",
+		},
+		{
+			Input{Lang: "sqlite3", Files: []box.File{{Body: "x"}}, Imports: []string{"t.csv"}},
+			"", "", "invalid dataset: no file 't.csv'",
+		},
+		{
+			Input{Lang: "sqlite3", Files: []box.File{{Name: "t.txt"}, {Body: "x"}}, Main: 1, Imports: []string{"t.txt"}},
+			"", "", "invalid dataset: import 't.txt' is not .csv or .sql",
+		},
+		{
+			Input{Lang: "sqlite3", Files: []box.File{{Name: "my data.csv"}, {Body: "x"}}, Main: 1, Imports: []string{"my data.csv"}},
+			"", "", "invalid dataset: cannot import 'my data.csv'",
+		},
+		{
+			Input{Lang: "python", Files: []box.File{{Body: "x"}}, Dataset: "chinook"},
+			"", "", "invalid dataset: datasets not supported for python",
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.input.Lang, tc.input.Dataset), func(t *testing.T) {
+			got, err := toLangOpts(r, tc.input)
+			if tc.wantError != "" {
+				require.EqualError(t, err, tc.wantError)
+				return
+			}
+			require.NoError(t, err)
+			opts := toBoxOpts(*got)
+			require.Equal(t, tc.wantCommand, opts.Command)
+			require.Equal(t, tc.wantMain, opts.Files[got.Input.Main].Body)
+		})
+	}
+}
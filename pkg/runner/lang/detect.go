@@ -0,0 +1,198 @@
+package lang
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/zetaoss/runbox/pkg/apperror"
+	"github.com/zetaoss/runbox/pkg/runner/box"
+)
+
+const (
+	DetectByExtension = "extension"
+	DetectByShebang   = "shebang"
+	DetectByContent   = "content"
+
+	// Content heuristics never claim more than this.
+	maxContentConfidence = 0.9
+)
+
+// DetectSpec tells how to recognise a language from a file name, a shebang
+// interpreter or its source.
+type DetectSpec struct {
+	Extensions   []string `yaml:"extensions,omitempty" json:"extensions,omitempty"`
+	Interpreters []string `yaml:"interpreters,omitempty" json:"interpreters,omitempty"`
+	Patterns     []string `yaml:"patterns,omitempty" json:"patterns,omitempty"`
+}
+
+type Detection struct {
+	Lang       string  `json:"lang"`
+	Confidence float64 `json:"confidence"`
+	Method     string  `json:"method"`
+}
+
+// AmbiguousError is an invalid language error that names the languages the
+// input could be.
+type AmbiguousError struct {
+	Candidates []string
+}
+
+func (e *AmbiguousError) Error() string {
+	return fmt.Sprintf("%s: ambiguous, candidates: %s", apperror.ErrInvalidLanguage, strings.Join(e.Candidates, ", "))
+}
+
+func (e *AmbiguousError) Unwrap() error {
+	return apperror.ErrInvalidLanguage
+}
+
+func compileDetect(patterns []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, p := range patterns {
+		re, err := regexp.Compile("(?m)" + p)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+var shebangPattern = regexp.MustCompile(`^#!\s*(\S+)(.*)`)
+
+// interpreter returns the program a shebang line runs, looking through env.
+func interpreter(source string) string {
+	line, _, _ := strings.Cut(source, "\n")
+	m := shebangPattern.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return ""
+	}
+	name := path.Base(m[1])
+	if name != "env" {
+		return name
+	}
+	for _, f := range strings.Fields(m[2]) {
+		if !strings.HasPrefix(f, "-") && !strings.Contains(f, "=") {
+			return path.Base(f)
+		}
+	}
+	return ""
+}
+
+// score counts the content patterns of a language that match the source.
+func (s Spec) score(source string) int {
+	n := 0
+	for _, re := range s.detectPatterns {
+		if re.MatchString(source) {
+			n++
+		}
+	}
+	return n
+}
+
+// Detect guesses the language of a file from its extension, then its
+// shebang, then content patterns. Content patterns only decide between the
+// languages claiming an extension or interpreter when there is more than one.
+func (r *Registry) Detect(f box.File) (*Detection, error) {
+	var specs []Spec
+	for _, name := range r.Names() {
+		s, _ := r.Lookup(name)
+		specs = append(specs, s)
+	}
+	candidates, method := specs, DetectByContent
+	if ext := strings.ToLower(strings.TrimPrefix(path.Ext(f.Name), ".")); ext != "" {
+		if c := filterSpecs(specs, func(s Spec) bool { return slices.Contains(s.Detect.Extensions, ext) }); len(c) > 0 {
+			candidates, method = c, DetectByExtension
+		}
+	}
+	if interp := interpreter(f.Body); interp != "" && method == DetectByContent {
+		if c := filterSpecs(specs, func(s Spec) bool { return slices.Contains(s.Detect.Interpreters, interp) }); len(c) > 0 {
+			candidates, method = c, DetectByShebang
+		}
+	}
+	if len(candidates) == 1 {
+		return &Detection{Lang: candidates[0].Name, Confidence: 1, Method: method}, nil
+	}
+
+	best, total := 0, 0
+	var top []string
+	for _, s := range candidates {
+		n := s.score(f.Body)
+		total += n
+		switch {
+		case n > best:
+			best, top = n, []string{s.Name}
+		case n == best && n > 0:
+			top = append(top, s.Name)
+		}
+	}
+	if best == 0 {
+		if method == DetectByContent {
+			return nil, fmt.Errorf("%w: cannot detect", apperror.ErrInvalidLanguage)
+		}
+		top = specNames(candidates)
+	}
+	if len(top) > 1 {
+		return nil, &AmbiguousError{Candidates: top}
+	}
+	confidence := float64(best) / float64(total)
+	if method == DetectByContent {
+		confidence *= maxContentConfidence
+	}
+	return &Detection{Lang: top[0], Confidence: float64(int(confidence*100)) / 100, Method: method}, nil
+}
+
+// Detect fills in the language of an input that has none, using its entry
+// file. A named entry file becomes the input's entry, or its main source
+// when the language only runs the default entry.
+func (l *Lang) Detect(input Input) (Input, *Detection, error) {
+	if len(input.Files) == 0 {
+		return input, nil, apperror.ErrNoFiles
+	}
+	main := input.Main
+	for i, f := range input.Files {
+		if input.Entry != "" && f.Name == input.Entry {
+			main = i
+		}
+	}
+	if main < 0 || main >= len(input.Files) {
+		return input, nil, apperror.ErrInvalidLanguage
+	}
+	d, err := l.registry.Detect(input.Files[main])
+	if err != nil {
+		return input, nil, err
+	}
+	input.Lang = d.Lang
+	if name := input.Files[main].Name; name != "" && input.Entry == "" {
+		spec, _ := l.registry.Lookup(d.Lang)
+		if spec.uses(entryMain) || spec.uses(entryMainClass) {
+			input.Entry = name
+		} else {
+			files := append([]box.File{}, input.Files...)
+			files[main].Name = ""
+			input.Files = files
+			input.Main = main
+		}
+	}
+	return input, d, nil
+}
+
+func filterSpecs(specs []Spec, keep func(Spec) bool) []Spec {
+	var res []Spec
+	for _, s := range specs {
+		if keep(s) {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+func specNames(specs []Spec) []string {
+	names := make([]string, len(specs))
+	for i, s := range specs {
+		names[i] = s.Name
+	}
+	return names
+}
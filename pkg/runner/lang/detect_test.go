@@ -0,0 +1,85 @@
+package lang
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zetaoss/runbox/pkg/apperror"
+	"github.com/zetaoss/runbox/pkg/runner/box"
+	"github.com/zetaoss/runbox/pkg/testutil"
+)
+
+func TestRegistry_Detect(t *testing.T) {
+	r := Builtin()
+	testCases := []struct {
+		file      box.File
+		want      *Detection
+		wantError string
+	}{
+		{box.File{Name: "hello.py", Body: "x"}, &Detection{Lang: "python", Confidence: 1, Method: DetectByExtension}, ""},
+		{box.File{Name: "Main.JAVA", Body: "x"}, &Detection{Lang: "java", Confidence: 1, Method: DetectByExtension}, ""},
+		{box.File{Name: "q.sql", Body: ".tables"}, &Detection{Lang: "sqlite3", Confidence: 1, Method: DetectByExtension}, ""},
+		{box.File{Name: "v.h", Body: "#include <vector>\nstd::vector<int> v;"}, &Detection{Lang: "cpp", Confidence: 1, Method: DetectByExtension}, ""},
+		{box.File{Name: "q.sql", Body: "SELECT 1;"}, nil, "invalid language: ambiguous, candidates: mysql, sqlite3"},
+		{box.File{Body: "#!/usr/bin/env python3\nprint(1)"}, &Detection{Lang: "python", Confidence: 1, Method: DetectByShebang}, ""},
+		{box.File{Name: "run", Body: "#!/bin/sh\necho hi"}, &Detection{Lang: "bash", Confidence: 1, Method: DetectByShebang}, ""},
+		{box.File{Name: "notes.txt", Body: "#!/usr/bin/env -S node --no-warnings\n"}, &Detection{Lang: "javascript", Confidence: 1, Method: DetectByShebang}, ""},
+		{box.File{Body: "print('hello')"}, &Detection{Lang: "python", Confidence: 0.9, Method: DetectByContent}, ""},
+		{box.File{Body: "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(1)\n}"}, &Detection{Lang: "go", Confidence: 0.9, Method: DetectByContent}, ""},
+		{box.File{Body: "#include <stdio.h>\nint main() { printf(\"hi\"); }"}, &Detection{Lang: "c", Confidence: 0.67, Method: DetectByContent}, ""},
+		{box.File{Body: "int main() { return 0; }"}, nil, "invalid language: ambiguous, candidates: c, cpp"},
+		{box.File{Body: "hello world"}, nil, "invalid language: cannot detect"},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.file.Name, tc.file.Body), func(t *testing.T) {
+			got, err := r.Detect(tc.file)
+			if tc.wantError != "" {
+				require.EqualError(t, err, tc.wantError)
+				require.ErrorIs(t, err, apperror.ErrInvalidLanguage)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestDetect(t *testing.T) {
+	l := &Lang{registry: Builtin()}
+	testCases := []struct {
+		input Input
+		want  Input
+	}{
+		{
+			Input{Files: []box.File{{Body: "puts 'hi'"}}},
+			Input{Lang: "ruby", Files: []box.File{{Body: "puts 'hi'"}}},
+		},
+		{
+			Input{Files: []box.File{{Name: "hello.py", Body: "x"}}},
+			Input{Lang: "python", Files: []box.File{{Name: "hello.py", Body: "x"}}, Entry: "hello.py"},
+		},
+		{
+			Input{Files: []box.File{{Name: "data.csv", Body: "1"}, {Name: "q.sql", Body: ".tables"}}, Main: 1},
+			Input{Lang: "sqlite3", Files: []box.File{{Name: "data.csv", Body: "1"}, {Body: ".tables"}}, Main: 1},
+		},
+		{
+			Input{Files: []box.File{{Name: "util.py", Body: "x"}, {Name: "app/main.py", Body: "x"}}, Entry: "app/main.py"},
+			Input{Lang: "python", Files: []box.File{{Name: "util.py", Body: "x"}, {Name: "app/main.py", Body: "x"}}, Entry: "app/main.py"},
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.input.Files), func(t *testing.T) {
+			got, _, err := l.Detect(tc.input)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestLookup_alias(t *testing.T) {
+	r := Builtin()
+	for _, name := range []string{"py", "Python", "c++", "golang", "js", "sh", "shell", "python3"} {
+		_, ok := r.Lookup(name)
+		require.True(t, ok, name)
+	}
+}
@@ -0,0 +1,252 @@
+package lang
+
+import (
+	"encoding/base64"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zetaoss/runbox/pkg/ansi"
+	"github.com/zetaoss/runbox/pkg/runner/box"
+)
+
+type Diagnostic struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Code     string `json:"code,omitempty"`
+}
+
+var (
+	// runbox.c:3:5: error: expected ';' [-Werror=...]
+	gccPattern = regexp.MustCompile(`^(\S+?):(\d+):(?:(\d+):)? (fatal error|error|warning|note): (.*?)(?: \[(-W[^\]]+)\])?$`)
+	// src/App.java:3: error: ';' expected
+	javacPattern = regexp.MustCompile(`^(\S+?\.java):(\d+): (error|warning): (.*)$`)
+	javacCaret   = regexp.MustCompile(`^\s*\^$`)
+	// runbox.cs(5,13): error CS1002: ; expected
+	// runbox.ts(2,7): error TS2322: Type 'string' is not assignable to type 'number'.
+	mcsPattern = regexp.MustCompile(`^(\S+?)\((\d+),(\d+)\): (error|warning) ((?:CS|TS)\d+): (.*)$`)
+	// error[E0425]: cannot find value `x` in this scope
+	//  --> src/main.rs:2:20
+	rustcPattern    = regexp.MustCompile(`^(error|warning)(?:\[(E\d+)\])?: (.*)$`)
+	rustcLocPattern = regexp.MustCompile(`^\s*--> (\S+?):(\d+):(\d+)$`)
+	// runbox.hs:2:8: error: [GHC-88464]
+	//     Variable not in scope: x
+	ghcPattern = regexp.MustCompile(`^(\S+?):(\d+):(\d+)(?:-\d+)?: (error|warning):?(?: \[([^\]]+)\])?(.*)$`)
+	// ./runbox.go:5:2: undefined: x
+	goPattern = regexp.MustCompile(`^(\S+?\.go):(\d+)(?::(\d+))?: (.*)$`)
+)
+
+var diagnosticParsers = map[string]func([]string) []Diagnostic{
+	"gcc": func(lines []string) []Diagnostic {
+		var ds []Diagnostic
+		for _, l := range lines {
+			m := gccPattern.FindStringSubmatch(l)
+			if m == nil {
+				continue
+			}
+			ds = append(ds, Diagnostic{
+				File:     m[1],
+				Line:     atoi(m[2]),
+				Column:   atoi(m[3]),
+				Severity: strings.TrimPrefix(m[4], "fatal "),
+				Message:  m[5],
+				Code:     m[6],
+			})
+		}
+		return ds
+	},
+	"javac": func(lines []string) []Diagnostic {
+		var ds []Diagnostic
+		for i, l := range lines {
+			m := javacPattern.FindStringSubmatch(l)
+			if m == nil {
+				continue
+			}
+			d := Diagnostic{File: m[1], Line: atoi(m[2]), Severity: m[3], Message: m[4]}
+			// javac echoes the source line and marks the column with a caret.
+			if i+2 < len(lines) && javacCaret.MatchString(lines[i+2]) {
+				d.Column = strings.Index(lines[i+2], "^") + 1
+			}
+			ds = append(ds, d)
+		}
+		return ds
+	},
+	"latex": parseTeXLog,
+	"mcs":   parseMCS,
+	"tsc":   parseMCS,
+	"rustc": func(lines []string) []Diagnostic {
+		var ds []Diagnostic
+		for i, l := range lines {
+			m := rustcPattern.FindStringSubmatch(l)
+			if m == nil || i+1 >= len(lines) {
+				continue
+			}
+			loc := rustcLocPattern.FindStringSubmatch(lines[i+1])
+			if loc == nil {
+				continue // summaries such as "error: aborting due to ..."
+			}
+			ds = append(ds, Diagnostic{
+				File:     loc[1],
+				Line:     atoi(loc[2]),
+				Column:   atoi(loc[3]),
+				Severity: m[1],
+				Message:  m[3],
+				Code:     m[2],
+			})
+		}
+		return ds
+	},
+	"ghc": func(lines []string) []Diagnostic {
+		var ds []Diagnostic
+		for i, l := range lines {
+			m := ghcPattern.FindStringSubmatch(l)
+			if m == nil {
+				continue
+			}
+			// The message follows on indented lines, up to the source excerpt.
+			msg := []string{}
+			if rest := strings.TrimSpace(m[6]); rest != "" {
+				msg = append(msg, rest)
+			}
+			for _, next := range lines[i+1:] {
+				trimmed := strings.TrimSpace(next)
+				if !strings.HasPrefix(next, " ") || trimmed == "" || strings.HasPrefix(trimmed, "|") {
+					break
+				}
+				msg = append(msg, strings.TrimPrefix(trimmed, "• "))
+			}
+			ds = append(ds, Diagnostic{
+				File:     m[1],
+				Line:     atoi(m[2]),
+				Column:   atoi(m[3]),
+				Severity: m[4],
+				Message:  strings.Join(msg, " "),
+				Code:     m[5],
+			})
+		}
+		return ds
+	},
+	"go": func(lines []string) []Diagnostic {
+		var ds []Diagnostic
+		for _, l := range lines {
+			m := goPattern.FindStringSubmatch(l)
+			if m == nil {
+				continue
+			}
+			ds = append(ds, Diagnostic{
+				File:     m[1],
+				Line:     atoi(m[2]),
+				Column:   atoi(m[3]),
+				Severity: "error",
+				Message:  m[4],
+			})
+		}
+		return ds
+	},
+}
+
+func parseMCS(lines []string) []Diagnostic {
+	var ds []Diagnostic
+	for _, l := range lines {
+		m := mcsPattern.FindStringSubmatch(l)
+		if m == nil {
+			continue
+		}
+		ds = append(ds, Diagnostic{
+			File:     m[1],
+			Line:     atoi(m[2]),
+			Column:   atoi(m[3]),
+			Severity: m[4],
+			Code:     m[5],
+			Message:  m[6],
+		})
+	}
+	return ds
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// Diagnostics parses the output of the compile step of a run into
+// diagnostics, with paths mapped back to the file names of the input.
+func (l *Lang) Diagnostics(input Input, result *box.Result) []Diagnostic {
+	if result == nil {
+		return nil
+	}
+	langOpts, err := toLangOpts(l.registry, input)
+	if err != nil {
+		return nil
+	}
+	spec, _ := l.registry.Lookup(langOpts.Input.Lang)
+	if spec.DiagnosticsFile != "" {
+		return l.diagnose(*langOpts, artifactLines(result, spec.DiagnosticsFile))
+	}
+	return l.diagnose(*langOpts, compileLines(spec.Diagnostics, result.Logs[:min(result.CompileLogs, len(result.Logs))]))
+}
+
+// compileLines keeps the compiler output its parser reads: stdout for tsc
+// and stderr for the rest.
+func compileLines(parser string, logs []box.Log) []string {
+	stream := 2
+	if parser == "tsc" {
+		stream = 1
+	}
+	var lines []string
+	for _, log := range logs {
+		if log.Stream == stream {
+			lines = append(lines, log.Log)
+		}
+	}
+	return lines
+}
+
+func artifactLines(result *box.Result, name string) []string {
+	for _, a := range result.Artifacts {
+		if a.Name != name {
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(a.Base64)
+		if err != nil {
+			return nil
+		}
+		return strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	}
+	return nil
+}
+
+func (l *Lang) diagnose(langOpts LangOpts, lines []string) []Diagnostic {
+	spec, _ := l.registry.Lookup(langOpts.Input.Lang)
+	parse, ok := diagnosticParsers[spec.Diagnostics]
+	if !ok {
+		return nil
+	}
+	stripped := make([]string, len(lines))
+	for i, line := range lines {
+		stripped[i] = ansi.Strip(line)
+	}
+	ds := parse(stripped)
+	names := map[string]string{}
+	for _, f := range langOpts.Input.Files {
+		name := f.Name
+		if name == "" {
+			name = langOpts.FileName + "." + langOpts.FileExt
+		}
+		names[resolveFullPath(f, langOpts)] = name
+	}
+	for i, d := range ds {
+		full := d.File
+		if !path.IsAbs(full) {
+			full = path.Join(langOpts.WorkingDir, full)
+		}
+		if name, ok := names[full]; ok {
+			ds[i].File = name
+		}
+	}
+	return ds
+}
@@ -0,0 +1,140 @@
+package lang
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zetaoss/runbox/pkg/runner/box"
+	"github.com/zetaoss/runbox/pkg/testutil"
+)
+
+func TestDiagnostics(t *testing.T) {
+	l := &Lang{registry: Builtin()}
+	testCases := []struct {
+		input Input
+		logs  string
+		want  []Diagnostic
+	}{
+		{
+			Input{Lang: "c", Files: []box.File{{Body: "int main() { return 0 }"}}},
+			"runbox.c: In function 'main':\n" +
+				"runbox.c:1:22: error: expected ';' before '}' token\n" +
+				"runbox.c:1:5: warning: unused variable 'x' [-Wunused-variable]\n" +
+				"\x1b[01mruntime.h:2:10:\x1b[m fatal error: stdio2.h: No such file or directory",
+			[]Diagnostic{
+				{File: "runbox.c", Line: 1, Column: 22, Severity: "error", Message: "expected ';' before '}' token"},
+				{File: "runbox.c", Line: 1, Column: 5, Severity: "warning", Message: "unused variable 'x'", Code: "-Wunused-variable"},
+				{File: "runtime.h", Line: 2, Column: 10, Severity: "error", Message: "stdio2.h: No such file or directory"},
+			},
+		},
+		{
+			Input{Lang: "java", Files: []box.File{{Name: "Util.java", Body: "class Util {}"}, {Body: "class App {}"}}, Main: 1},
+			"src/Util.java:3: error: ';' expected\n" +
+				"        int x = 1\n" +
+				"                 ^\n" +
+				"src/App.java:1: warning: [deprecation] foo() has been deprecated\n" +
+				"1 error",
+			[]Diagnostic{
+				{File: "Util.java", Line: 3, Column: 18, Severity: "error", Message: "';' expected"},
+				{File: "App.java", Line: 1, Severity: "warning", Message: "[deprecation] foo() has been deprecated"},
+			},
+		},
+		{
+			Input{Lang: "csharp", Files: []box.File{{Body: "class A {}"}}},
+			"runbox.cs(5,13): error CS1002: ; expected\nCompilation failed: 1 error(s), 0 warnings",
+			[]Diagnostic{
+				{File: "runbox.cs", Line: 5, Column: 13, Severity: "error", Message: "; expected", Code: "CS1002"},
+			},
+		},
+		{
+			Input{Lang: "go", Files: []box.File{{Name: "util/util.go", Body: "package util"}, {Body: "package main"}}, Main: 1},
+			"# command-line-arguments\n./runbox.go:5:2: undefined: x\n/go/src/m/util/util.go:3: missing return",
+			[]Diagnostic{
+				{File: "runbox.go", Line: 5, Column: 2, Severity: "error", Message: "undefined: x"},
+				{File: "util/util.go", Line: 3, Severity: "error", Message: "missing return"},
+			},
+		},
+		{
+			Input{Lang: "typescript", Files: []box.File{{Name: "math.ts", Body: "export {}"}, {Body: "x"}}, Main: 1},
+			"math.ts(2,7): error TS2322: Type 'string' is not assignable to type 'number'.",
+			[]Diagnostic{
+				{File: "math.ts", Line: 2, Column: 7, Severity: "error", Message: "Type 'string' is not assignable to type 'number'.", Code: "TS2322"},
+			},
+		},
+		{
+			Input{Lang: "rust", Files: []box.File{{Name: "util.rs", Body: "pub fn f() {}"}, {Body: "mod util;"}}, Main: 1},
+			"error[E0425]: cannot find value `x` in this scope\n" +
+				" --> runbox.rs:2:20\n" +
+				"  |\n" +
+				"warning: unused variable: `y`\n" +
+				" --> util.rs:1:9\n" +
+				"error: aborting due to 1 previous error",
+			[]Diagnostic{
+				{File: "runbox.rs", Line: 2, Column: 20, Severity: "error", Message: "cannot find value `x` in this scope", Code: "E0425"},
+				{File: "util.rs", Line: 1, Column: 9, Severity: "warning", Message: "unused variable: `y`"},
+			},
+		},
+		{
+			Input{Lang: "zig", Files: []box.File{{Body: "x"}}},
+			"runbox.zig:2:5: error: use of undeclared identifier 'x'",
+			[]Diagnostic{
+				{File: "runbox.zig", Line: 2, Column: 5, Severity: "error", Message: "use of undeclared identifier 'x'"},
+			},
+		},
+		{
+			Input{Lang: "swift", Files: []box.File{{Body: "x"}}},
+			"/home/user01/main.swift:1:1: error: cannot find 'x' in scope",
+			[]Diagnostic{
+				{File: "main.swift", Line: 1, Column: 1, Severity: "error", Message: "cannot find 'x' in scope"},
+			},
+		},
+		{
+			Input{Lang: "haskell", Files: []box.File{{Body: "main = print x"}}},
+			"runbox.hs:1:14: error: [GHC-88464]\n" +
+				"    Variable not in scope: x\n" +
+				"  |\n" +
+				"1 | main = print x\n" +
+				"runbox.hs:3:1: warning: [GHC-40910] [-Wunused-top-binds]\n" +
+				"    • Defined but not used: \u2018f\u2019",
+			[]Diagnostic{
+				{File: "runbox.hs", Line: 1, Column: 14, Severity: "error", Message: "Variable not in scope: x", Code: "GHC-88464"},
+				{File: "runbox.hs", Line: 3, Column: 1, Severity: "warning", Message: "[-Wunused-top-binds] Defined but not used: \u2018f\u2019", Code: "GHC-40910"},
+			},
+		},
+		{
+			Input{Lang: "python", Files: []box.File{{Body: "x"}}},
+			"runbox.py:1:1: error: not a compiler",
+			nil,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.input.Lang), func(t *testing.T) {
+			stream := 2
+			if tc.input.Lang == "typescript" {
+				stream = 1
+			}
+			result := &box.Result{}
+			for _, line := range strings.Split(tc.logs, "\n") {
+				result.Logs = append(result.Logs, box.Log{Stream: stream, Log: line})
+			}
+			result.CompileLogs = len(result.Logs)
+			// The program prints the same lines, which must not count.
+			result.Logs = append(result.Logs, result.Logs...)
+			require.Equal(t, tc.want, l.Diagnostics(tc.input, result))
+		})
+	}
+}
+
+func TestDiagnostics_stream(t *testing.T) {
+	l := &Lang{registry: Builtin()}
+	result := &box.Result{
+		Logs: []box.Log{
+			{Stream: 1, Log: "runbox.c:1:5: error: not from stderr"},
+			{Stream: 2, Log: "runbox.ts(1,1): error TS1005: not from stdout"},
+		},
+		CompileLogs: 2,
+	}
+	require.Nil(t, l.Diagnostics(Input{Lang: "c", Files: []box.File{{Body: "x"}}}, result))
+	require.Nil(t, l.Diagnostics(Input{Lang: "typescript", Files: []box.File{{Body: "x"}}}, result))
+}
@@ -0,0 +1,296 @@
+package lang
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/zetaoss/runbox/pkg/apperror"
+	"github.com/zetaoss/runbox/pkg/runner/box"
+)
+
+const (
+	VerdictAccepted            = "AC"
+	VerdictWrongAnswer         = "WA"
+	VerdictTimeLimitExceeded   = "TLE"
+	VerdictMemoryLimitExceeded = "MLE"
+	VerdictRuntimeError        = "RE"
+	VerdictCompileError        = "CE"
+)
+
+const (
+	judgeDir          = "/tmp/judge"
+	defaultTimeLimit  = 2000 // ms
+	maxTimeLimit      = 60000
+	checkerTimeLimit  = 10000
+	minMemoryLimit    = 6 << 10 // KiB, the least docker accepts
+	maxJudgeCases     = 100
+	judgeOutputLimit  = 1 << 20
+	maxDiffLines      = 1000
+	timedOutExitCode  = 124 // timeout's own, after it stopped the case
+	killedExitCode    = 137
+	timeoutOverheadMs = 1000
+)
+
+type JudgeInput struct {
+	Submission Input       `json:"submission"`
+	Cases      []JudgeCase `json:"cases"`
+	// Checker is a shell script called as `checker input expected actual`;
+	// exit code 0 accepts the answer. Without it outputs are compared line
+	// by line, ignoring trailing whitespace.
+	Checker     string `json:"checker,omitempty"`
+	TimeLimit   int    `json:"timeLimit,omitempty"`   // ms
+	MemoryLimit int    `json:"memoryLimit,omitempty"` // KiB
+}
+
+type JudgeCase struct {
+	Stdin       string `json:"stdin"`
+	Expected    string `json:"expected"`
+	TimeLimit   int    `json:"timeLimit,omitempty"`
+	MemoryLimit int    `json:"memoryLimit,omitempty"`
+}
+
+type JudgeResult struct {
+	Verdict     string       `json:"verdict"`
+	Compile     []string     `json:"compile,omitempty"`
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+	Cases       []CaseResult `json:"cases"`
+}
+
+type CaseResult struct {
+	Verdict string `json:"verdict"`
+	Code    int    `json:"code,omitempty"`
+	Time    int    `json:"time"`
+	Stdout  string `json:"stdout,omitempty"`
+	Stderr  string `json:"stderr,omitempty"`
+	Diff    string `json:"diff,omitempty"`
+}
+
+// Judge compiles a submission once and runs it against every case in the
+// same container, each case in a process of its own under `timeout` and
+// the case's memory limit. Expected outputs and the checker never enter that
+// container: outputs are compared here, and the checker runs in another.
+func (l *Lang) Judge(input JudgeInput) (*JudgeResult, error) {
+	if len(input.Cases) == 0 || len(input.Cases) > maxJudgeCases {
+		return nil, apperror.ErrInvalidCases
+	}
+	langOpts, err := l.langOpts(input.Submission)
+	if err != nil {
+		return nil, err
+	}
+	limits := make([]int, len(input.Cases))
+	for i, c := range input.Cases {
+		limits[i] = c.TimeLimit
+		if limits[i] == 0 {
+			limits[i] = input.TimeLimit
+		}
+		if limits[i] == 0 {
+			limits[i] = defaultTimeLimit
+		}
+		if m := memoryLimit(input, c); limits[i] < 0 || limits[i] > maxTimeLimit || m < 0 || m > 0 && m < minMemoryLimit {
+			return nil, apperror.ErrInvalidCases
+		}
+	}
+
+	boxOpts := toBoxOpts(*langOpts)
+	boxOpts.Command = langOpts.Compile
+	if boxOpts.Command == "" {
+		boxOpts.Command = "true"
+	}
+	boxOpts.Compile = ""
+	boxOpts.CollectImages = false
+	boxOpts.Tty = false
+	boxOpts.Base64Binary = false
+	boxOpts.OutputEncoding = ""
+	boxOpts.MaxOutputBytes = judgeOutputLimit
+	for i, c := range input.Cases {
+		boxOpts.Steps = append(boxOpts.Steps, box.Step{
+			Args:    []string{"timeout", "-k", "0.1", fmt.Sprintf("%d.%03d", limits[i]/1000, limits[i]%1000), langOpts.Shell, "-c", langOpts.Run},
+			Stdin:   c.Stdin,
+			Timeout: limits[i] + timeoutOverheadMs,
+			Memory:  int64(memoryLimit(input, c)) << 10,
+		})
+	}
+	boxResult, err := l.box.Run(&boxOpts)
+	if err != nil {
+		return nil, err
+	}
+	var checks map[int]int
+	if input.Checker != "" {
+		if checks, err = l.check(boxOpts, input, boxResult.Steps); err != nil {
+			return nil, err
+		}
+	}
+	result := judgeResult(boxResult, input, limits, checks)
+	if result.Verdict == VerdictCompileError {
+		result.Diagnostics = l.diagnose(*langOpts, result.Compile)
+	}
+	return result, nil
+}
+
+// check runs the checker on every case that exited cleanly, in a container
+// of its own, and returns its exit code by case.
+func (l *Lang) check(submission box.Opts, input JudgeInput, steps []box.StepResult) (map[int]int, error) {
+	opts := box.Opts{
+		Command:         "true",
+		Files:           []box.File{{Name: judgeDir + "/checker", Body: input.Checker}},
+		Image:           submission.Image,
+		Memory:          submission.Memory,
+		MaxOutputBytes:  judgeOutputLimit,
+		NetworkDisabled: true,
+		Runtime:         submission.Runtime,
+		User:            submission.User,
+		WorkingDir:      judgeDir,
+	}
+	var cases []int
+	for i, step := range steps {
+		if step.Code != 0 || step.Timedout {
+			continue
+		}
+		cases = append(cases, i)
+		in, ans, out := fmt.Sprintf("%s/%d.in", judgeDir, i), fmt.Sprintf("%s/%d.ans", judgeDir, i), fmt.Sprintf("%s/%d.out", judgeDir, i)
+		opts.Files = append(opts.Files,
+			box.File{Name: in, Body: input.Cases[i].Stdin},
+			box.File{Name: ans, Body: input.Cases[i].Expected},
+			box.File{Name: out, Body: step.Stdout},
+		)
+		opts.Steps = append(opts.Steps, box.Step{Args: []string{"sh", judgeDir + "/checker", in, ans, out}, Timeout: checkerTimeLimit})
+	}
+	if len(cases) == 0 {
+		return nil, nil
+	}
+	result, err := l.box.Run(&opts)
+	if err != nil {
+		return nil, err
+	}
+	checks := map[int]int{}
+	for j, step := range result.Steps {
+		checks[cases[j]] = step.Code
+		if step.Timedout {
+			checks[cases[j]] = killedExitCode
+		}
+	}
+	return checks, nil
+}
+
+func memoryLimit(input JudgeInput, c JudgeCase) int {
+	if c.MemoryLimit > 0 {
+		return c.MemoryLimit
+	}
+	return input.MemoryLimit
+}
+
+var memoryErrorPattern = regexp.MustCompile(`(?i)MemoryError|bad_alloc|OutOfMemoryError|out of memory|Cannot allocate memory|failed to map segment`)
+
+// judgeResult gives each case its verdict from the step that ran it. The
+// box's own command is the compile, whose output is reported when it fails.
+// A case ran out of time when timeout stopped it, or killed it without a
+// memory limit that could have; its wall-clock time is only reported.
+func judgeResult(boxResult *box.Result, input JudgeInput, limits []int, checks map[int]int) *JudgeResult {
+	result := &JudgeResult{Verdict: VerdictAccepted, Cases: make([]CaseResult, len(input.Cases))}
+	compileFailed := boxResult.Code != 0 || boxResult.Timedout
+	if compileFailed {
+		for _, l := range boxResult.Logs {
+			result.Compile = append(result.Compile, l.Log)
+		}
+	}
+	for i, c := range input.Cases {
+		cr := &result.Cases[i]
+		var step box.StepResult
+		if i < len(boxResult.Steps) {
+			step = boxResult.Steps[i]
+			*cr = CaseResult{
+				Code:   step.Code,
+				Time:   step.Time,
+				Stdout: strings.ToValidUTF8(step.Stdout, "\uFFFD"),
+				Stderr: strings.ToValidUTF8(step.Stderr, "\uFFFD"),
+			}
+		}
+		switch {
+		case compileFailed:
+			cr.Verdict = VerdictCompileError
+		case step.Timedout || cr.Code == timedOutExitCode || cr.Code == killedExitCode && memoryLimit(input, c) == 0:
+			cr.Verdict = VerdictTimeLimitExceeded
+		case cr.Code != 0 && memoryLimit(input, c) > 0 && (cr.Code == killedExitCode || memoryErrorPattern.MatchString(cr.Stderr)):
+			cr.Verdict = VerdictMemoryLimitExceeded
+		case cr.Code != 0:
+			cr.Verdict = VerdictRuntimeError
+		case input.Checker != "":
+			cr.Verdict = VerdictWrongAnswer
+			if code, ok := checks[i]; ok && code == 0 {
+				cr.Verdict = VerdictAccepted
+			}
+		case sameOutput(c.Expected, cr.Stdout):
+			cr.Verdict = VerdictAccepted
+		default:
+			cr.Verdict = VerdictWrongAnswer
+			cr.Diff = diffLines(normalizeOutput(c.Expected), normalizeOutput(cr.Stdout))
+		}
+		if result.Verdict == VerdictAccepted && cr.Verdict != VerdictAccepted {
+			result.Verdict = cr.Verdict
+		}
+	}
+	return result
+}
+
+// normalizeOutput drops trailing whitespace on each line and trailing blank lines.
+func normalizeOutput(s string) []string {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " \t\r")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func sameOutput(expected, actual string) bool {
+	a, b := normalizeOutput(expected), normalizeOutput(actual)
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// diffLines returns a line diff of expected (-) against actual (+). Long
+// outputs are cut to keep the table small.
+func diffLines(a, b []string) string {
+	a = a[:min(len(a), maxDiffLines)]
+	b = b[:min(len(b), maxDiffLines)]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var sb strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			sb.WriteString(" " + a[i] + "\n")
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			sb.WriteString("-" + a[i] + "\n")
+			i++
+		default:
+			sb.WriteString("+" + b[j] + "\n")
+			j++
+		}
+	}
+	return sb.String()
+}
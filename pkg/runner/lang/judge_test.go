@@ -0,0 +1,94 @@
+package lang
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zetaoss/runbox/pkg/runner/box"
+	"github.com/zetaoss/runbox/pkg/testutil"
+)
+
+func TestJudgeResult(t *testing.T) {
+	cases := []JudgeCase{
+		{Expected: "3\n"},
+		{Expected: "5\n"},
+		{Expected: ""},
+		{Expected: ""},
+		{Expected: "", MemoryLimit: 8192},
+		{Expected: "", MemoryLimit: 8192},
+		{Expected: ""},
+		{Expected: ""},
+		{Expected: ""},
+	}
+	limits := []int{1000, 1000, 1000, 1000, 1000, 1000, 1000, 1000, 1000}
+	testCases := []struct {
+		boxResult *box.Result
+		want      *JudgeResult
+	}{
+		{
+			&box.Result{Steps: []box.StepResult{
+				{Stdout: "3  \n\n", Time: 5},
+				{Stdout: "4\n", Time: 5},
+				{Code: 124, Time: 1003},
+				{Code: 1, Time: 5, Stderr: "panic"},
+				{Code: 1, Time: 5, Stderr: "MemoryError"},
+				{Code: 137, Time: 20},
+				{Time: 1000, Timedout: true},
+				{Code: 137, Time: 1100},
+				{Time: 1200},
+			}},
+			&JudgeResult{Verdict: VerdictWrongAnswer, Cases: []CaseResult{
+				{Verdict: VerdictAccepted, Time: 5, Stdout: "3  \n\n"},
+				{Verdict: VerdictWrongAnswer, Time: 5, Stdout: "4\n", Diff: "-5\n+4\n"},
+				{Verdict: VerdictTimeLimitExceeded, Code: 124, Time: 1003},
+				{Verdict: VerdictRuntimeError, Code: 1, Time: 5, Stderr: "panic"},
+				{Verdict: VerdictMemoryLimitExceeded, Code: 1, Time: 5, Stderr: "MemoryError"},
+				{Verdict: VerdictMemoryLimitExceeded, Code: 137, Time: 20},
+				{Verdict: VerdictTimeLimitExceeded, Time: 1000},
+				{Verdict: VerdictTimeLimitExceeded, Code: 137, Time: 1100},
+				{Verdict: VerdictAccepted, Time: 1200},
+			}},
+		},
+		{
+			&box.Result{Code: 1, Logs: []box.Log{{Stream: 2, Log: "runbox.c:1:1: error: x"}}},
+			&JudgeResult{Verdict: VerdictCompileError, Compile: []string{"runbox.c:1:1: error: x"}, Cases: []CaseResult{
+				{Verdict: VerdictCompileError}, {Verdict: VerdictCompileError}, {Verdict: VerdictCompileError}, {Verdict: VerdictCompileError},
+				{Verdict: VerdictCompileError}, {Verdict: VerdictCompileError}, {Verdict: VerdictCompileError},
+				{Verdict: VerdictCompileError}, {Verdict: VerdictCompileError},
+			}},
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i), func(t *testing.T) {
+			got := judgeResult(tc.boxResult, JudgeInput{Cases: cases}, limits, nil)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestJudgeResult_checker(t *testing.T) {
+	boxResult := &box.Result{Steps: []box.StepResult{{Stdout: "3.0001", Time: 5}, {Time: 5}, {Code: 1, Time: 5}}}
+	input := JudgeInput{Cases: []JudgeCase{{Expected: "3"}, {Expected: "4"}, {Expected: "5"}}, Checker: "exit 0"}
+	got := judgeResult(boxResult, input, []int{1000, 1000, 1000}, map[int]int{0: 0, 1: 1})
+	require.Equal(t, VerdictWrongAnswer, got.Verdict)
+	require.Equal(t, VerdictAccepted, got.Cases[0].Verdict)
+	require.Equal(t, VerdictWrongAnswer, got.Cases[1].Verdict)
+	require.Equal(t, VerdictRuntimeError, got.Cases[2].Verdict)
+}
+
+func TestDiffLines(t *testing.T) {
+	testCases := []struct {
+		a, b []string
+		want string
+	}{
+		{[]string{"a", "b", "c"}, []string{"a", "b", "c"}, " a\n b\n c\n"},
+		{[]string{"a", "b", "c"}, []string{"a", "x", "c"}, " a\n-b\n+x\n c\n"},
+		{[]string{"a"}, []string{"a", "b"}, " a\n+b\n"},
+		{[]string{"a", "b"}, nil, "-a\n-b\n"},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i), func(t *testing.T) {
+			require.Equal(t, tc.want, diffLines(tc.a, tc.b))
+		})
+	}
+}
@@ -3,64 +3,216 @@ package lang
 import (
 	"fmt"
 	"path"
+	"slices"
 	"strings"
 
 	"github.com/zetaoss/runbox/pkg/apperror"
+	"github.com/zetaoss/runbox/pkg/cache"
 	"github.com/zetaoss/runbox/pkg/runner/box"
 	"k8s.io/utils/ptr"
 )
 
 type Lang struct {
-	box *box.Box
+	box      *box.Box
+	caches   []cache.Cache
+	envs     *cache.Envs
+	registry *Registry
+	runtimes *RuntimeConfig
 }
 
 func New(box *box.Box) *Lang {
-	return &Lang{box}
+	return &Lang{box: box, registry: Builtin()}
+}
+
+func (l *Lang) Box() *box.Box {
+	return l.box
+}
+
+func (l *Lang) Registry() *Registry {
+	return l.registry
+}
+
+func (l *Lang) SetRegistry(registry *Registry) {
+	l.registry = registry
+}
+
+func (l *Lang) Languages() []string {
+	return l.registry.Names()
+}
+
+func (l *Lang) Image(lang string) string {
+	return l.registry.Image(lang)
+}
+
+func (l *Lang) Version(lang, version string) string {
+	return l.registry.Version(lang, version)
+}
+
+func Image(lang string) string {
+	return fmt.Sprintf("ghcr.io/zetaoss/runcontainers/%s", lang)
+}
+
+func (l *Lang) SetCaches(caches []cache.Cache) {
+	l.caches = caches
+}
+
+func (l *Lang) SetEnvs(envs *cache.Envs) {
+	l.envs = envs
+}
+
+func (l *Lang) SetRuntimes(runtimes *RuntimeConfig) error {
+	if err := runtimes.Validate(l.box.HasRuntime); err != nil {
+		return err
+	}
+	l.runtimes = runtimes
+	return nil
+}
+
+// Tenant returns the tenant of an API key from the runtime config.
+func (l *Lang) Tenant(key string) string {
+	return l.runtimes.Tenant(key)
 }
 
 type Input struct {
-	Lang  string     `json:"lang"`
-	Files []box.File `json:"files"`
-	Main  int        `json:"main,omitempty"`
+	Lang           string       `json:"lang"`
+	Version        string       `json:"version,omitempty"`
+	CompileArgs    []string     `json:"compileArgs,omitempty"`
+	RuntimeArgs    []string     `json:"runtimeArgs,omitempty"`
+	RunArgs        []string     `json:"runArgs,omitempty"`
+	Files          []box.File   `json:"files"`
+	Manifest       string       `json:"manifest,omitempty"`
+	Entry          string       `json:"entry,omitempty"`
+	Main           int          `json:"main,omitempty"`
+	OutputEncoding string       `json:"outputEncoding,omitempty"`
+	Base64Binary   bool         `json:"base64Binary,omitempty"`
+	Tty            bool         `json:"tty,omitempty"`
+	Render         string       `json:"render,omitempty"`
+	Phases         bool         `json:"phases,omitempty"`
+	SQL            bool         `json:"sql,omitempty"`
+	Dataset        string       `json:"dataset,omitempty"`
+	Imports        []string     `json:"imports,omitempty"`
+	TeX            *TeXOptions  `json:"tex,omitempty"`
+	Plot           *PlotOptions `json:"plot,omitempty"`
+	Tenant         string       `json:"-"`
 }
 
 type LangOpts struct {
 	Input              Input
+	Artifacts          []string
 	Command            string
 	CollectImagesCount int
+	Compile            string
 	Env                []string
 	FileDir            string
 	FileName           string
 	FileExt            string
 	FileMain           int
+	Image              string
+	MaxImageKB         int
+	MaxImagesKB        int
+	MemoryMB           int
 	ModifyMainFunc     func(string) string
-	Shell              string
-	TimeoutSeconds     int
-	User               string
-	WorkingDir         string
+	Mounts             []box.Mount
+	// Prepare runs in the same shell before the command.
+	Prepare        string
+	Run            string
+	Runtime        string
+	Shell          string
+	TimeoutSeconds int
+	User           string
+	WorkingDir     string
+}
+
+func (l *Lang) Run(input Input, runOpts box.RunOptions) (*box.Result, error) {
+	langOpts, err := l.langOpts(input)
+	if err != nil {
+		return nil, err
+	}
+	boxOpts := toBoxOpts(*langOpts)
+	if err := runOpts.Apply(&boxOpts, l.box.Limits()); err != nil {
+		return nil, err
+	}
+	return l.box.Run(&boxOpts)
 }
 
-func (l *Lang) Run(input Input, extraOpts ...map[string]int) (*box.Result, error) {
-	langOpts, err := toLangOpts(input)
+func (l *Lang) langOpts(input Input) (*LangOpts, error) {
+	langOpts, err := toLangOpts(l.registry, input)
 	if err != nil {
-		if err == apperror.ErrInvalidLanguage || err == apperror.ErrNoFiles {
+		if apperror.IsAppError(err) {
 			return nil, err
 		}
 		return nil, fmt.Errorf("toLangOpts err: %w", err)
 	}
-	for _, o := range extraOpts {
-		for k, v := range o {
-			if k == "timeoutSeconds" {
-				langOpts.TimeoutSeconds = v + 1
-			}
+	if c, ok := cache.Find(l.caches, langOpts.Input.Lang); ok {
+		langOpts.Env = addEnv(langOpts.Env, c.Env...)
+		langOpts.Mounts = append(langOpts.Mounts, c.Mount(true))
+	}
+	if input.Manifest != "" {
+		if err := l.useEnv(langOpts); err != nil {
+			return nil, err
 		}
 	}
-	boxOpts := toBoxOpts(*langOpts)
-	return l.box.Run(&boxOpts)
+	langOpts.Runtime = l.runtimes.Resolve(langOpts.Input.Lang, input.Tenant)
+	return langOpts, nil
+}
+
+// useEnv installs the dependency manifest named by the input, or reuses an
+// environment installed earlier from the same manifest.
+func (l *Lang) useEnv(langOpts *LangOpts) error {
+	if l.envs == nil {
+		return fmt.Errorf("%w: manifests are not enabled", apperror.ErrInvalidManifest)
+	}
+	var manifest *box.File
+	for i, f := range langOpts.Input.Files {
+		if f.Name == langOpts.Input.Manifest {
+			manifest = &langOpts.Input.Files[i]
+			break
+		}
+	}
+	if manifest == nil {
+		return fmt.Errorf("%w: no file '%s'", apperror.ErrInvalidManifest, langOpts.Input.Manifest)
+	}
+	env, err := l.envs.Prepare(langOpts.Input.Lang, langOpts.Image, *manifest)
+	if err != nil {
+		if apperror.IsAppError(err) {
+			return err
+		}
+		return fmt.Errorf("prepare err: %w", err)
+	}
+	langOpts.Env = addEnv(langOpts.Env, env.Env...)
+	langOpts.Mounts = append(langOpts.Mounts, env.Mount)
+	if env.Setup != "" {
+		langOpts.Command = env.Setup + langOpts.Command
+		langOpts.Run = env.Setup + langOpts.Run
+		if langOpts.Compile != "" {
+			langOpts.Compile = env.Setup + langOpts.Compile
+		}
+	}
+	return nil
+}
+
+// listEnv names the variables holding colon-separated lists, which are
+// joined rather than set twice when hooks and environments both add to them.
+var listEnv = []string{"PYTHONPATH"}
+
+// addEnv appends vars to env, joining list variables env already sets.
+func addEnv(env []string, vars ...string) []string {
+	env = slices.Clone(env)
+	for _, v := range vars {
+		name, value, _ := strings.Cut(v, "=")
+		i := slices.IndexFunc(env, func(e string) bool { return strings.HasPrefix(e, name+"=") })
+		if i < 0 || !slices.Contains(listEnv, name) {
+			env = append(env, v)
+			continue
+		}
+		env[i] += ":" + value
+	}
+	return env
 }
 
 func toBoxOpts(langOpts LangOpts) box.Opts {
-	filesMap := map[string]string{}
+	files := []box.File{}
+	index := map[string]int{}
 	for i, f := range langOpts.Input.Files {
 		name := resolveFullPath(f, langOpts)
 
@@ -68,29 +220,44 @@ func toBoxOpts(langOpts LangOpts) box.Opts {
 			f.Body = langOpts.ModifyMainFunc(f.Body)
 		}
 
-		if existing, ok := filesMap[name]; ok {
-			filesMap[name] = existing + "\n" + f.Body
-		} else {
-			filesMap[name] = f.Body
+		if j, ok := index[name]; ok {
+			files[j].Body += "\n" + f.Body
+			continue
 		}
-	}
-
-	files := []box.File{}
-	for name, body := range filesMap {
+		index[name] = len(files)
 		files = append(files, box.File{
 			Name: name,
-			Body: body,
+			Body: f.Body,
 		})
 	}
 
+	image := langOpts.Image
+	if image == "" {
+		image = Image(langOpts.Input.Lang)
+	}
+	// Compiling on its own keeps the compiler output apart from the program's.
+	command, compile := langOpts.Prepare+langOpts.Command, ""
+	if langOpts.Compile != "" {
+		command, compile = langOpts.Prepare+langOpts.Run, langOpts.Compile
+	}
 	return box.Opts{
+		Artifacts:          langOpts.Artifacts,
 		CollectStats:       ptr.To(true),
 		CollectImages:      true,
 		CollectImagesCount: langOpts.CollectImagesCount,
-		Command:            langOpts.Command,
+		Command:            command,
+		Compile:            compile,
 		Env:                langOpts.Env,
 		Files:              files,
-		Image:              fmt.Sprintf("ghcr.io/zetaoss/runcontainers/%s", langOpts.Input.Lang),
+		Image:              image,
+		MaxImageBytes:      int64(langOpts.MaxImageKB) << 10,
+		MaxImagesBytes:     int64(langOpts.MaxImagesKB) << 10,
+		Memory:             int64(langOpts.MemoryMB) << 20,
+		Mounts:             langOpts.Mounts,
+		OutputEncoding:     langOpts.Input.OutputEncoding,
+		Base64Binary:       langOpts.Input.Base64Binary,
+		Tty:                langOpts.Input.Tty,
+		Runtime:            langOpts.Runtime,
 		Shell:              langOpts.Shell,
 		Timeout:            langOpts.TimeoutSeconds * 1000,
 		User:               langOpts.User,
@@ -106,102 +273,13 @@ func resolveFullPath(f box.File, langOpts LangOpts) string {
 	return path.Join(langOpts.WorkingDir, langOpts.FileDir, name)
 }
 
-func toLangOpts(input Input) (*LangOpts, error) {
+func toLangOpts(r *Registry, input Input) (*LangOpts, error) {
 	if len(input.Files) == 0 {
 		return nil, apperror.ErrNoFiles
 	}
-	var opts = &LangOpts{
-		Input:          input,
-		Command:        "",
-		FileName:       "runbox",
-		FileExt:        input.Lang,
-		FileDir:        "",
-		ModifyMainFunc: nil,
-		Shell:          "sh",
-		TimeoutSeconds: 10,
-		WorkingDir:     "/home/user01",
-	}
-	switch input.Lang {
-	case "bash":
-		opts.Command = "/bin/bash runbox.sh"
-		opts.FileExt = "sh"
-		opts.Shell = "bash"
-	case "c":
-		opts.Command = "gcc runbox.c; ./a.out"
-	case "cpp":
-		opts.Command = "g++ runbox.cpp; ./a.out"
-	case "csharp":
-		opts.Command = "mcs runbox.cs; mono runbox.exe"
-		opts.FileExt = "cs"
-	case "java":
-		opts.Command = `javac -d bin -cp "lib/*" src/*; java -cp "bin:lib/*" App`
-		opts.FileDir = "/src"
-		opts.FileName = "App"
-		opts.WorkingDir = "/demo"
-	case "kotlin":
-		opts.Command = "kotlinc runbox.kt -include-runtime -d runbox.jar && java -jar runbox.jar"
-		opts.FileExt = "kt"
-		opts.TimeoutSeconds = 40
-	case "go":
-		opts.Command = "go mod tidy > /dev/null 2>&1; go run runbox.go"
-		opts.Env = []string{"TINI_SUBREAPER=1"}
-		opts.TimeoutSeconds = 30
-		opts.WorkingDir = "/go/src/m"
-	case "latex":
-		opts.FileExt = "tex"
-		opts.CollectImagesCount = 10
-		opts.Command = "touch oblivoir.sty && pdflatex -halt-on-error runbox.tex && convert runbox.pdf -strip p%d.png"
-		opts.TimeoutSeconds = 30
-		opts.User = "root"
-	case "lua":
-		opts.Command = "lua runbox.lua"
-	case "mysql":
-		opts.Command = "bash /tmp/entrypoint.sh"
-		opts.FileExt = "sql"
-		opts.TimeoutSeconds = 30
-	case "perl":
-		opts.Command = "perl runbox.pl"
-		opts.FileExt = "pl"
-	case "php":
-		opts.Command = "php runbox.php"
-		opts.ModifyMainFunc = func(source string) string {
-			source = strings.TrimLeft(source, " \t\n")
-			if source[:5] != "<?php" {
-				source = "<?php\nrequire_once('vendor/autoload.php');\n" + source
-			}
-			return source
-		}
-	case "powershell":
-		opts.Command = "pwsh runbox.ps"
-		opts.FileExt = "ps"
-	case "python":
-		opts.Command = "python runbox.py"
-		opts.FileExt = "py"
-	case "r":
-		opts.Command = "Rscript runbox.r"
-		opts.ModifyMainFunc = func(source string) string {
-			return "png(width=500,height=400);\n" + source + "\n" + `options(echo=F); invisible(dev.off());system('find . -name "*.pdf" -exec mogrify -density 80 -format png {} \\;',ignore.stdout=T,ignore.stderr=F);`
-		}
-	case "ruby":
-		opts.Command = "ruby runbox.rb"
-		opts.FileExt = "rb"
-	case "sqlite3":
-		opts.FileExt = "sql"
-		source := input.Files[0].Body
-		if strings.HasPrefix(source, ".") {
-			opts.Command = "sqlite3 chinook.db " + source
-		} else {
-			opts.Command = "sqlite3 -header chinook.db < runbox.sql"
-		}
-		input.Files[0].Body = source
-	case "tex":
-		opts.FileExt = "tex"
-		opts.CollectImagesCount = 10
-		opts.Command = "touch oblivoir.sty && pdflatex -halt-on-error runbox.tex && convert runbox.pdf -strip p%d.png"
-		opts.TimeoutSeconds = 30
-		opts.User = "root"
-	default:
+	spec, ok := r.Lookup(input.Lang)
+	if !ok {
 		return nil, apperror.ErrInvalidLanguage
 	}
-	return opts, nil
+	return spec.langOpts(input)
 }
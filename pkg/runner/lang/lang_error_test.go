@@ -18,10 +18,11 @@ func TestRun_error(t *testing.T) {
 		{Input{Lang: "go", Files: []box.File{}}, "no files"},
 		{Input{Lang: "", Files: []box.File{{Body: `echo hello`}}}, "invalid language"},
 		{Input{Lang: "x", Files: []box.File{{Body: `echo hello`}}}, "invalid language"},
+		{Input{Lang: "python", Files: []box.File{{Body: `import numpy`}, {Name: "requirements.txt", Body: "numpy"}}, Manifest: "requirements.txt"}, "invalid manifest: manifests are not enabled"},
 	}
 	for _, tc := range testCases {
 		t.Run(testutil.Name(tc.langInput), func(t *testing.T) {
-			output, err := lang1.Run(tc.langInput)
+			output, err := lang1.Run(tc.langInput, box.RunOptions{})
 			require.Nil(t, output)
 			require.EqualError(t, err, tc.wantError)
 		})
@@ -88,7 +89,7 @@ func TestRun_timeout(t *testing.T) {
 	}
 	for i, tc := range testCases {
 		t.Run(testutil.Name(i, tc.input), func(t *testing.T) {
-			got, err := lang1.Run(tc.input, map[string]int{"timeoutSeconds": 1})
+			got, err := lang1.Run(tc.input, box.RunOptions{TimeoutSeconds: 2})
 			require.NoError(t, err)
 			equalResult(t, tc.want, got)
 		})
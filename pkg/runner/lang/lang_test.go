@@ -92,7 +92,7 @@ func TestRun_bash(t *testing.T) {
 	}
 	for i, tc := range testCases {
 		t.Run(testutil.Name(i, tc.input), func(t *testing.T) {
-			got, err := lang1.Run(tc.input)
+			got, err := lang1.Run(tc.input, box.RunOptions{})
 			require.NoError(t, err)
 			equalResult(t, tc.want, got)
 		})
@@ -144,7 +144,7 @@ func TestRun_c(t *testing.T) {
 	}
 	for i, tc := range testCases {
 		t.Run(testutil.Name(i, tc.input), func(t *testing.T) {
-			got, err := lang1.Run(tc.input)
+			got, err := lang1.Run(tc.input, box.RunOptions{})
 			require.NoError(t, err)
 			equalResult(t, tc.want, got)
 		})
@@ -176,7 +176,7 @@ func TestRun_cpp(t *testing.T) {
 	}
 	for i, tc := range testCases {
 		t.Run(testutil.Name(i, tc.input), func(t *testing.T) {
-			got, err := lang1.Run(tc.input)
+			got, err := lang1.Run(tc.input, box.RunOptions{})
 			require.NoError(t, err)
 			equalResult(t, tc.want, got)
 		})
@@ -211,7 +211,35 @@ func TestRun_csharp(t *testing.T) {
 	}
 	for i, tc := range testCases {
 		t.Run(testutil.Name(i, tc.input), func(t *testing.T) {
-			got, err := lang1.Run(tc.input)
+			got, err := lang1.Run(tc.input, box.RunOptions{})
+			require.NoError(t, err)
+			equalResult(t, tc.want, got)
+		})
+	}
+}
+
+func TestRun_haskell(t *testing.T) {
+	testCases := []struct {
+		input Input
+		want  *box.Result
+	}{
+		{
+			Input{
+				Lang: "haskell",
+				Files: []box.File{
+					{Name: "Greet.hs", Body: "module Greet (greet) where\n\ngreet :: String -> String\ngreet name = \"Hello, \" ++ name ++ \"!\""},
+					{Body: "import Greet\n\nmain :: IO ()\nmain = putStrLn (greet \"Haskell\")"},
+				},
+				Main: 1,
+			},
+			&box.Result{
+				Logs: []box.Log{{Stream: 1, Log: "Hello, Haskell!"}},
+			},
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.input), func(t *testing.T) {
+			got, err := lang1.Run(tc.input, box.RunOptions{})
 			require.NoError(t, err)
 			equalResult(t, tc.want, got)
 		})
@@ -271,7 +299,45 @@ func TestRun_java(t *testing.T) {
 	}
 	for i, tc := range testCases {
 		t.Run(testutil.Name(i, tc.input), func(t *testing.T) {
-			got, err := lang1.Run(tc.input)
+			got, err := lang1.Run(tc.input, box.RunOptions{})
+			require.NoError(t, err)
+			equalResult(t, tc.want, got)
+		})
+	}
+}
+
+func TestRun_javascript(t *testing.T) {
+	testCases := []struct {
+		input Input
+		want  *box.Result
+	}{
+		{
+			Input{
+				Lang:  "javascript",
+				Files: []box.File{{Body: `console.log("Hello, World!")`}},
+			},
+			&box.Result{
+				Logs: []box.Log{{Stream: 1, Log: "Hello, World!"}},
+			},
+		},
+		{
+			Input{
+				Lang: "javascript",
+				Files: []box.File{
+					{Name: "greet.js", Body: "export const greet = (name) => `Hello, ${name}!`;"},
+					{Body: `import { greet } from "./greet.js";` + "\n" + `console.log(greet(process.argv[2]));`},
+				},
+				Main:    1,
+				RunArgs: []string{"ES module"},
+			},
+			&box.Result{
+				Logs: []box.Log{{Stream: 1, Log: "Hello, ES module!"}},
+			},
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.input), func(t *testing.T) {
+			got, err := lang1.Run(tc.input, box.RunOptions{})
 			require.NoError(t, err)
 			equalResult(t, tc.want, got)
 		})
@@ -301,7 +367,7 @@ func TestRun_kotlin(t *testing.T) {
 	}
 	for i, tc := range testCases {
 		t.Run(testutil.Name(i, tc.input), func(t *testing.T) {
-			got, err := lang1.Run(tc.input)
+			got, err := lang1.Run(tc.input, box.RunOptions{})
 			require.NoError(t, err)
 			equalResult(t, tc.want, got)
 		})
@@ -333,7 +399,7 @@ func TestRun_go(t *testing.T) {
 	}
 	for i, tc := range testCases {
 		t.Run(testutil.Name(i, tc.input), func(t *testing.T) {
-			got, err := lang1.Run(tc.input)
+			got, err := lang1.Run(tc.input, box.RunOptions{})
 			require.NoError(t, err)
 			equalResult(t, tc.want, got)
 		})
@@ -449,7 +515,7 @@ func TestRun_latex(t *testing.T) {
 	}
 	for i, tc := range testCases {
 		t.Run(testutil.Name(i, tc.input), func(t *testing.T) {
-			got, err := lang1.Run(tc.input)
+			got, err := lang1.Run(tc.input, box.RunOptions{})
 			require.NoError(t, err)
 			equalResult(t, tc.want, got)
 		})
@@ -476,7 +542,7 @@ func TestRun_lua(t *testing.T) {
 	}
 	for i, tc := range testCases {
 		t.Run(testutil.Name(i, tc.input), func(t *testing.T) {
-			got, err := lang1.Run(tc.input)
+			got, err := lang1.Run(tc.input, box.RunOptions{})
 			require.NoError(t, err)
 			equalResult(t, tc.want, got)
 		})
@@ -509,7 +575,7 @@ func TestRun_mysql(t *testing.T) {
 	}
 	for i, tc := range testCases {
 		t.Run(testutil.Name(i, tc.input), func(t *testing.T) {
-			got, err := lang1.Run(tc.input)
+			got, err := lang1.Run(tc.input, box.RunOptions{})
 			require.NoError(t, err)
 			equalResult(t, tc.want, got)
 		})
@@ -540,7 +606,7 @@ func TestRun_perl(t *testing.T) {
 	}
 	for i, tc := range testCases {
 		t.Run(testutil.Name(i, tc.input), func(t *testing.T) {
-			got, err := lang1.Run(tc.input)
+			got, err := lang1.Run(tc.input, box.RunOptions{})
 			require.NoError(t, err)
 			equalResult(t, tc.want, got)
 		})
@@ -601,7 +667,7 @@ func TestRun_php(t *testing.T) {
 	}
 	for i, tc := range testCases {
 		t.Run(testutil.Name(i, tc.input), func(t *testing.T) {
-			got, err := lang1.Run(tc.input)
+			got, err := lang1.Run(tc.input, box.RunOptions{})
 			require.NoError(t, err)
 			equalResult(t, tc.want, got)
 		})
@@ -628,7 +694,7 @@ func TestRun_powershell(t *testing.T) {
 	}
 	for i, tc := range testCases {
 		t.Run(testutil.Name(i, tc.input), func(t *testing.T) {
-			got, err := lang1.Run(tc.input)
+			got, err := lang1.Run(tc.input, box.RunOptions{})
 			require.NoError(t, err)
 			equalResult(t, tc.want, got)
 		})
@@ -658,7 +724,7 @@ func TestRun_python(t *testing.T) {
 	}
 	for i, tc := range testCases {
 		t.Run(testutil.Name(i, tc.input), func(t *testing.T) {
-			got, err := lang1.Run(tc.input)
+			got, err := lang1.Run(tc.input, box.RunOptions{})
 			require.NoError(t, err)
 			equalResult(t, tc.want, got)
 		})
@@ -688,7 +754,7 @@ func TestRun_r(t *testing.T) {
 	}
 	for i, tc := range testCases {
 		t.Run(testutil.Name(i, tc.input), func(t *testing.T) {
-			got, err := lang1.Run(tc.input)
+			got, err := lang1.Run(tc.input, box.RunOptions{})
 			require.NoError(t, err)
 			equalResult(t, tc.want, got)
 		})
@@ -718,7 +784,55 @@ func TestRun_ruby(t *testing.T) {
 	}
 	for i, tc := range testCases {
 		t.Run(testutil.Name(i, tc.input), func(t *testing.T) {
-			got, err := lang1.Run(tc.input)
+			got, err := lang1.Run(tc.input, box.RunOptions{})
+			require.NoError(t, err)
+			equalResult(t, tc.want, got)
+		})
+	}
+}
+
+func TestRun_rust(t *testing.T) {
+	testCases := []struct {
+		input Input
+		want  *box.Result
+	}{
+		{
+			Input{
+				Lang: "rust",
+				Files: []box.File{
+					{Name: "greet.rs", Body: "pub fn greet(name: &str) -> String {\n    format!(\"Hello, {}!\", name)\n}"},
+					{Body: "mod greet;\n\nfn main() {\n    println!(\"{}\", greet::greet(\"Rust\"));\n}"},
+				},
+				Main: 1,
+			},
+			&box.Result{
+				Logs: []box.Log{{Stream: 1, Log: "Hello, Rust!"}},
+			},
+		},
+		{
+			Input{
+				Lang:  "rust",
+				Files: []box.File{{Body: "fn main() {\n    println!(\"{}\", x);\n}"}},
+			},
+			&box.Result{
+				Logs: []box.Log{
+					{Stream: 2, Log: "error[E0425]: cannot find value `x` in this scope"},
+					{Stream: 2, Log: " --> runbox.rs:2:20"},
+					{Stream: 2, Log: "  |"},
+					{Stream: 2, Log: "2 |     println!(\"{}\", x);"},
+					{Stream: 2, Log: "  |                    ^ not found in this scope"},
+					{Stream: 2, Log: ""},
+					{Stream: 2, Log: "error: aborting due to 1 previous error"},
+					{Stream: 2, Log: ""},
+					{Stream: 2, Log: "For more information about this error, try `rustc --explain E0425`."},
+				},
+				Code: 1,
+			},
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.input), func(t *testing.T) {
+			got, err := lang1.Run(tc.input, box.RunOptions{})
 			require.NoError(t, err)
 			equalResult(t, tc.want, got)
 		})
@@ -754,7 +868,35 @@ func TestRun_sqlite3(t *testing.T) {
 	}
 	for i, tc := range testCases {
 		t.Run(testutil.Name(i, tc.input), func(t *testing.T) {
-			got, err := lang1.Run(tc.input)
+			got, err := lang1.Run(tc.input, box.RunOptions{})
+			require.NoError(t, err)
+			equalResult(t, tc.want, got)
+		})
+	}
+}
+
+func TestRun_swift(t *testing.T) {
+	testCases := []struct {
+		input Input
+		want  *box.Result
+	}{
+		{
+			Input{
+				Lang: "swift",
+				Files: []box.File{
+					{Name: "Greet.swift", Body: "func greet(_ name: String) -> String {\n    return \"Hello, \\(name)!\"\n}"},
+					{Body: "print(greet(\"Swift\"))"},
+				},
+				Main: 1,
+			},
+			&box.Result{
+				Logs: []box.Log{{Stream: 1, Log: "Hello, Swift!"}},
+			},
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.input), func(t *testing.T) {
+			got, err := lang1.Run(tc.input, box.RunOptions{})
 			require.NoError(t, err)
 			equalResult(t, tc.want, got)
 		})
@@ -870,7 +1012,69 @@ func TestRun_tex(t *testing.T) {
 	}
 	for i, tc := range testCases {
 		t.Run(testutil.Name(i, tc.input), func(t *testing.T) {
-			got, err := lang1.Run(tc.input)
+			got, err := lang1.Run(tc.input, box.RunOptions{})
+			require.NoError(t, err)
+			equalResult(t, tc.want, got)
+		})
+	}
+}
+
+func TestRun_typescript(t *testing.T) {
+	testCases := []struct {
+		input Input
+		want  *box.Result
+	}{
+		{
+			Input{
+				Lang: "typescript",
+				Files: []box.File{
+					{Name: "math.ts", Body: `export function add(a: number, b: number): number { return a + b; }`},
+					{Body: `import { add } from "./math.js";` + "\n" + `const n: number = add(1, 2);` + "\n" + `console.log(n);`},
+				},
+				Main: 1,
+			},
+			&box.Result{
+				Logs: []box.Log{{Stream: 1, Log: "3"}},
+			},
+		},
+		{
+			Input{
+				Lang:  "typescript",
+				Files: []box.File{{Body: `const n: number = "one";`}},
+			},
+			&box.Result{
+				Logs: []box.Log{{Stream: 1, Log: "runbox.ts(1,7): error TS2322: Type 'string' is not assignable to type 'number'."}},
+				Code: 2,
+			},
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.input), func(t *testing.T) {
+			got, err := lang1.Run(tc.input, box.RunOptions{})
+			require.NoError(t, err)
+			equalResult(t, tc.want, got)
+		})
+	}
+}
+
+func TestRun_zig(t *testing.T) {
+	testCases := []struct {
+		input Input
+		want  *box.Result
+	}{
+		{
+			Input{
+				Lang:  "zig",
+				Files: []box.File{{Body: "const std = @import(\"std\");\n\npub fn main() void {\n    std.debug.print(\"Hello, Zig!\\n\", .{});\n}"}},
+			},
+			&box.Result{
+				Logs: []box.Log{{Stream: 2, Log: "Hello, Zig!"}},
+			},
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.input), func(t *testing.T) {
+			got, err := lang1.Run(tc.input, box.RunOptions{})
 			require.NoError(t, err)
 			equalResult(t, tc.want, got)
 		})
@@ -0,0 +1,119 @@
+package lang
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/zetaoss/runbox/pkg/apperror"
+)
+
+// Commands refer to the entry point with these placeholders: its path from
+// the working directory, or for Java its class name.
+const (
+	entryMain      = "main"
+	entryMainClass = "mainClass"
+)
+
+const (
+	maxPathLength = 255
+	maxPathDepth  = 16
+)
+
+var plainWordPattern = regexp.MustCompile(`^[A-Za-z0-9._/-]+$`)
+
+// checkPath accepts relative slash-separated names that stay below the
+// file directory.
+func checkPath(name string) error {
+	if len(name) > maxPathLength {
+		return fmt.Errorf("%w: '%s' is too long", apperror.ErrInvalidPath, name)
+	}
+	if strings.HasPrefix(name, "/") {
+		return fmt.Errorf("%w: '%s' is absolute", apperror.ErrInvalidPath, name)
+	}
+	if strings.IndexFunc(name, func(r rune) bool { return r == '\\' || unicode.IsControl(r) }) >= 0 {
+		return fmt.Errorf("%w: '%s' has a backslash or control character", apperror.ErrInvalidPath, name)
+	}
+	parts := strings.Split(name, "/")
+	if len(parts) > maxPathDepth {
+		return fmt.Errorf("%w: '%s' is too deep", apperror.ErrInvalidPath, name)
+	}
+	for _, p := range parts {
+		switch p {
+		case "..":
+			return fmt.Errorf("%w: '%s' leaves the working directory", apperror.ErrInvalidPath, name)
+		case "", ".":
+			return fmt.Errorf("%w: '%s' has an empty or '.' segment", apperror.ErrInvalidPath, name)
+		}
+	}
+	return nil
+}
+
+// checkFiles validates every file name. Unnamed files make up the main
+// source together; a named file may appear only once.
+func (s Spec) checkFiles(input Input) error {
+	seen := map[string]bool{}
+	unnamed := false
+	for _, f := range input.Files {
+		if f.Name == "" {
+			unnamed = true
+			continue
+		}
+		if err := checkPath(f.Name); err != nil {
+			return err
+		}
+		if seen[f.Name] {
+			return fmt.Errorf("%w: duplicate '%s'", apperror.ErrInvalidPath, f.Name)
+		}
+		seen[f.Name] = true
+	}
+	if name := s.mainName(); unnamed && seen[name] {
+		return fmt.Errorf("%w: duplicate '%s'", apperror.ErrInvalidPath, name)
+	}
+	return nil
+}
+
+func (s Spec) mainName() string {
+	return s.FileName + "." + s.FileExt
+}
+
+// entry returns the index of the entry file and its name. Without an
+// explicit entry the command runs the default main name.
+func (s Spec) entry(input Input) (int, string, error) {
+	if input.Entry == "" {
+		return input.Main, s.mainName(), nil
+	}
+	for i, f := range input.Files {
+		if f.Name != input.Entry && (f.Name != "" || input.Entry != s.mainName()) {
+			continue
+		}
+		if input.Entry != s.mainName() && !s.uses(entryMain) && !s.uses(entryMainClass) {
+			return 0, "", fmt.Errorf("%w: entry not supported for %s", apperror.ErrInvalidEntry, s.Name)
+		}
+		return i, input.Entry, nil
+	}
+	return 0, "", fmt.Errorf("%w: no file '%s'", apperror.ErrInvalidEntry, input.Entry)
+}
+
+func (s Spec) uses(name string) bool {
+	p := placeholder(name)
+	return strings.Contains(s.Command, p) || strings.Contains(s.Compile, p) || strings.Contains(s.Run, p)
+}
+
+// entryReplacements are the strings.NewReplacer pairs of the entry file and
+// its Java class name.
+func entryReplacements(fileDir, entry string) []string {
+	main := path.Join(strings.TrimPrefix(fileDir, "/"), entry)
+	class := strings.ReplaceAll(strings.TrimSuffix(entry, path.Ext(entry)), "/", ".")
+	return []string{placeholder(entryMain), shellWord(main), placeholder(entryMainClass), shellWord(class)}
+}
+
+// shellWord quotes s only when it is not a plain path.
+func shellWord(s string) string {
+	if plainWordPattern.MatchString(s) {
+		return s
+	}
+	return shellQuote(s)
+}
@@ -0,0 +1,106 @@
+package lang
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zetaoss/runbox/pkg/runner/box"
+	"github.com/zetaoss/runbox/pkg/testutil"
+)
+
+func TestCheckPath(t *testing.T) {
+	testCases := []struct {
+		name      string
+		wantError string
+	}{
+		{"greet.txt", ""},
+		{"com/example/Util.java", ""},
+		{"my data.csv", ""},
+		{"../../etc/x", "invalid path: '../../etc/x' leaves the working directory"},
+		{"a/../../x", "invalid path: 'a/../../x' leaves the working directory"},
+		{"/etc/passwd", "invalid path: '/etc/passwd' is absolute"},
+		{"a//b", "invalid path: 'a//b' has an empty or '.' segment"},
+		{"./a", "invalid path: './a' has an empty or '.' segment"},
+		{"dir/", "invalid path: 'dir/' has an empty or '.' segment"},
+		{`a\b`, `invalid path: 'a\b' has a backslash or control character`},
+		{"a\nb", "invalid path: 'a\nb' has a backslash or control character"},
+		{"a/b/c/d/e/f/g/h/i/j/k/l/m/n/o/p/q", "invalid path: 'a/b/c/d/e/f/g/h/i/j/k/l/m/n/o/p/q' is too deep"},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.name), func(t *testing.T) {
+			err := checkPath(tc.name)
+			if tc.wantError == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tc.wantError)
+			}
+		})
+	}
+}
+
+func TestEntry(t *testing.T) {
+	r := Builtin()
+	testCases := []struct {
+		input       Input
+		wantCommand string
+		wantMain    int
+		wantError   string
+	}{
+		{
+			Input{Lang: "python", Files: []box.File{{Name: "util.py", Body: "x"}, {Body: "import util"}}, Main: 1},
+			"python runbox.py", 1, "",
+		},
+		{
+			Input{Lang: "python", Files: []box.File{{Name: "app/util.py"}, {Name: "app/main.py"}}, Entry: "app/main.py"},
+			"python app/main.py", 1, "",
+		},
+		{
+			Input{Lang: "python", Files: []box.File{{Name: "my app.py"}}, Entry: "my app.py"},
+			"python 'my app.py'", 0, "",
+		},
+		{
+			Input{Lang: "python", Files: []box.File{{Name: "util.py"}, {Body: "x"}}, Entry: "runbox.py"},
+			"python runbox.py", 1, "",
+		},
+		{
+			Input{Lang: "java", Files: []box.File{{Name: "com/example/Util.java"}, {Name: "com/example/Main.java"}}, Entry: "com/example/Main.java"},
+			`javac -d bin -cp "lib/*:/cache/java/lib/*" $(find src -name '*.java'); java -cp "bin:lib/*:/cache/java/lib/*" com.example.Main`, 1, "",
+		},
+		{
+			Input{Lang: "go", Files: []box.File{{Name: "go.mod"}, {Name: "cmd/app/main.go"}}, Entry: "cmd/app/main.go"},
+			"go mod tidy > /dev/null 2>&1; go run cmd/app/main.go", 1, "",
+		},
+		{
+			Input{Lang: "python", Files: []box.File{{Name: "util.py"}}, Entry: "main.py"},
+			"", 0, "invalid entry: no file 'main.py'",
+		},
+		{
+			Input{Lang: "sqlite3", Files: []box.File{{Name: "query.sql"}}, Entry: "query.sql"},
+			"", 0, "invalid entry: entry not supported for sqlite3",
+		},
+		{
+			Input{Lang: "python", Files: []box.File{{Name: "../x.py"}}},
+			"", 0, "invalid path: '../x.py' leaves the working directory",
+		},
+		{
+			Input{Lang: "python", Files: []box.File{{Name: "a.py"}, {Name: "a.py"}}},
+			"", 0, "invalid path: duplicate 'a.py'",
+		},
+		{
+			Input{Lang: "python", Files: []box.File{{Name: "runbox.py"}, {Body: "x"}}},
+			"", 0, "invalid path: duplicate 'runbox.py'",
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.input.Lang, tc.input.Entry), func(t *testing.T) {
+			got, err := toLangOpts(r, tc.input)
+			if tc.wantError != "" {
+				require.EqualError(t, err, tc.wantError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.wantCommand, got.Command)
+			require.Equal(t, tc.wantMain, got.Input.Main)
+		})
+	}
+}
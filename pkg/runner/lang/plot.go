@@ -0,0 +1,167 @@
+package lang
+
+import (
+	"fmt"
+	"path"
+	"slices"
+
+	"github.com/zetaoss/runbox/pkg/apperror"
+)
+
+const (
+	defaultPlotWidth  = 500
+	defaultPlotHeight = 400
+	minPlotSize       = 100
+	maxPlotSize       = 4000
+)
+
+// PlotOptions picks the format, png or svg, and the size in pixels of the
+// figures a run captures.
+type PlotOptions struct {
+	Format string `json:"format,omitempty"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+var plotHooks = []string{"julia-plot", "python-plot", "r-plot"}
+
+// plotOptions returns the request's plot options with defaults filled in.
+// sized reports whether the request set a size itself.
+func plotOptions(opts *LangOpts) (o PlotOptions, sized bool, err error) {
+	if opts.Input.Plot != nil {
+		o = *opts.Input.Plot
+	}
+	sized = o.Width != 0 || o.Height != 0
+	if o.Format == "" {
+		o.Format = "png"
+	}
+	if o.Format != "png" && o.Format != "svg" {
+		return o, false, fmt.Errorf("%w: plot format '%s' not supported", apperror.ErrInvalidArgs, o.Format)
+	}
+	if o.Width == 0 {
+		o.Width = defaultPlotWidth
+	}
+	if o.Height == 0 {
+		o.Height = defaultPlotHeight
+	}
+	for _, n := range []int{o.Width, o.Height} {
+		if n < minPlotSize || n > maxPlotSize {
+			return o, false, fmt.Errorf("%w: plot size must be between %d and %d", apperror.ErrInvalidArgs, minPlotSize, maxPlotSize)
+		}
+	}
+	return o, sized, nil
+}
+
+// plotPath is where the n-th figure is saved, with n left as a %03d verb.
+func plotPath(opts *LangOpts, format string) string {
+	return path.Join(opts.WorkingDir, "plot-%03d."+format)
+}
+
+// pythonPlot sets matplotlib to a backend that saves every figure when it is
+// shown, and any left open at exit. matplotlibrc only sets defaults, so a
+// figsize or dpi in the code still wins.
+func pythonPlot(opts *LangOpts) error {
+	o, _, err := plotOptions(opts)
+	if err != nil {
+		return err
+	}
+	addDefaultFile(opts, "matplotlibrc", fmt.Sprintf("figure.figsize: %g, %g\nfigure.dpi: 100\n", float64(o.Width)/100, float64(o.Height)/100))
+	addDefaultFile(opts, "runbox_plot.py", fmt.Sprintf(`import atexit
+
+from matplotlib._pylab_helpers import Gcf
+from matplotlib.backend_bases import FigureManagerBase
+from matplotlib.backends.backend_agg import FigureCanvasAgg
+
+FigureCanvas = FigureCanvasAgg
+FigureManager = FigureManagerBase
+
+_path = %q
+_count = 0
+
+
+def show(*args, **kwargs):
+    global _count
+    for manager in Gcf.get_all_fig_managers():
+        _count += 1
+        manager.canvas.figure.savefig(_path %% _count)
+    Gcf.destroy_all()
+
+
+atexit.register(show)
+`, plotPath(opts, o.Format)))
+	opts.Env = addEnv(opts.Env, "MPLBACKEND=module://runbox_plot", "PYTHONPATH="+opts.WorkingDir)
+	return nil
+}
+
+// rPlot opens a device that writes one file per page. Plots drawn after the
+// code closes it land in Rplots.pdf, whose pages become PNGs as well.
+func rPlot(opts *LangOpts) error {
+	o, _, err := plotOptions(opts)
+	if err != nil {
+		return err
+	}
+	device := fmt.Sprintf("png(%q, width=%d, height=%d);", plotPath(opts, "png"), o.Width, o.Height)
+	after := `system('find . -name "*.pdf" -exec mogrify -density 80 -format png {} \\;',ignore.stdout=T,ignore.stderr=F);`
+	if o.Format == "svg" {
+		device = fmt.Sprintf("svg(%q, width=%g, height=%g, onefile=FALSE);", plotPath(opts, "svg"), float64(o.Width)/72, float64(o.Height)/72)
+		after = ""
+	}
+	opts.ModifyMainFunc = func(source string) string {
+		return device + "\n" + source + "\n" + "options(echo=F); invisible(dev.off());" + after
+	}
+	return nil
+}
+
+// juliaPlot puts a display in front of the one Plots.jl pushes when it loads,
+// saving every plot the code displays and the current plot at exit when none
+// was. The include shares the first line of the code so line numbers stay put.
+func juliaPlot(opts *LangOpts) error {
+	o, sized, err := plotOptions(opts)
+	if err != nil {
+		return err
+	}
+	size := "nothing"
+	if sized {
+		size = fmt.Sprintf("(%d, %d)", o.Width, o.Height)
+	}
+	file := path.Join(opts.WorkingDir, "runbox_plot.jl")
+	addDefaultFile(opts, "runbox_plot.jl", fmt.Sprintf(`module RunboxPlot
+
+const FORMAT = %q
+const SIZE = %s
+const count = Ref(0)
+
+struct PlotDisplay <: AbstractDisplay end
+
+function Base.display(d::PlotDisplay, x)
+    isdefined(Main, :Plots) && x isa Main.Plots.Plot || throw(MethodError(display, (d, x)))
+    SIZE === nothing || Base.invokelatest(Main.Plots.plot!, x; size=SIZE)
+    count[] += 1
+    name = joinpath(%q, string("plot-", lpad(count[], 3, '0'), ".", FORMAT))
+    Base.invokelatest(Main.Plots.savefig, x, name)
+    return nothing
+end
+
+function finish()
+    count[] == 0 && isdefined(Main, :Plots) || return
+    display(PlotDisplay(), Base.invokelatest(Main.Plots.current))
+end
+
+end
+
+ENV["GKSwstype"] = "100"
+push!(Base.package_callbacks, pkg -> pkg.name == "Plots" && pushdisplay(RunboxPlot.PlotDisplay()))
+atexit(() -> try RunboxPlot.finish() catch end)
+`, o.Format, size, opts.WorkingDir))
+	opts.ModifyMainFunc = func(source string) string {
+		return fmt.Sprintf("include(%q); ", file) + source
+	}
+	return nil
+}
+
+func checkPlot(s Spec, input Input) error {
+	if input.Plot == nil || slices.ContainsFunc(s.Hooks, func(h string) bool { return slices.Contains(plotHooks, h) }) {
+		return nil
+	}
+	return fmt.Errorf("%w: plot options not supported for %s", apperror.ErrInvalidArgs, s.Name)
+}
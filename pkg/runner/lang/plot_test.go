@@ -0,0 +1,100 @@
+package lang
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zetaoss/runbox/pkg/cache"
+	"github.com/zetaoss/runbox/pkg/runner/box"
+	"github.com/zetaoss/runbox/pkg/testutil"
+)
+
+func TestPlotHooks(t *testing.T) {
+	r := Builtin()
+	testCases := []struct {
+		input     Input
+		wantMain  string
+		wantFiles []string
+		wantEnv   []string
+		wantError string
+	}{
+		{
+			Input{Lang: "python", Files: []box.File{{Body: "import matplotlib.pyplot as plt"}}},
+			"import matplotlib.pyplot as plt",
+			[]string{"/home/user01/runbox.py", "/home/user01/matplotlibrc", "/home/user01/runbox_plot.py"},
+			[]string{"MPLBACKEND=module://runbox_plot", "PYTHONPATH=/home/user01"},
+			"",
+		},
+		{
+			Input{Lang: "r", Files: []box.File{{Body: "plot(1:3)"}}, Plot: &PlotOptions{Format: "svg", Width: 720, Height: 360}},
+			"svg(\"/home/user01/plot-%03d.svg\", width=10, height=5, onefile=FALSE);\nplot(1:3)\noptions(echo=F); invisible(dev.off());",
+			[]string{"/home/user01/runbox.r"}, nil, "",
+		},
+		{
+			Input{Lang: "r", Files: []box.File{{Body: "plot(1:3)"}}},
+			"png(\"/home/user01/plot-%03d.png\", width=500, height=400);\nplot(1:3)\noptions(echo=F); invisible(dev.off());" +
+				`system('find . -name "*.pdf" -exec mogrify -density 80 -format png {} \\;',ignore.stdout=T,ignore.stderr=F);`,
+			[]string{"/home/user01/runbox.r"}, nil, "",
+		},
+		{
+			Input{Lang: "julia", Files: []box.File{{Body: "using Plots"}}},
+			"include(\"/home/user01/runbox_plot.jl\"); using Plots",
+			[]string{"/home/user01/runbox.jl", "/home/user01/runbox_plot.jl"}, nil, "",
+		},
+		{
+			Input{Lang: "python", Files: []box.File{{Body: "x"}}, Plot: &PlotOptions{Format: "gif"}},
+			"", nil, nil, "invalid args: plot format 'gif' not supported",
+		},
+		{
+			Input{Lang: "r", Files: []box.File{{Body: "x"}}, Plot: &PlotOptions{Width: 10000}},
+			"", nil, nil, "invalid args: plot size must be between 100 and 4000",
+		},
+		{
+			Input{Lang: "ruby", Files: []box.File{{Body: "x"}}, Plot: &PlotOptions{}},
+			"", nil, nil, "invalid args: plot options not supported for ruby",
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.input.Lang), func(t *testing.T) {
+			got, err := toLangOpts(r, tc.input)
+			if tc.wantError != "" {
+				require.EqualError(t, err, tc.wantError)
+				return
+			}
+			require.NoError(t, err)
+			opts := toBoxOpts(*got)
+			var names []string
+			for _, f := range opts.Files {
+				names = append(names, f.Name)
+			}
+			require.Equal(t, tc.wantFiles, names)
+			require.Equal(t, tc.wantMain, opts.Files[0].Body)
+			require.Equal(t, tc.wantEnv, opts.Env)
+			require.Equal(t, 20, opts.CollectImagesCount)
+			require.Equal(t, int64(4096<<10), opts.MaxImagesBytes)
+		})
+	}
+}
+
+func TestPythonPlotFiles(t *testing.T) {
+	got, err := toLangOpts(Builtin(), Input{Lang: "python", Files: []box.File{{Body: "x"}}, Plot: &PlotOptions{Format: "svg", Width: 800, Height: 600}})
+	require.NoError(t, err)
+	require.Equal(t, "figure.figsize: 8, 6\nfigure.dpi: 100\n", got.Input.Files[1].Body)
+	require.Contains(t, got.Input.Files[2].Body, "_path = \"/home/user01/plot-%03d.svg\"\n")
+	require.Contains(t, got.Input.Files[2].Body, "savefig(_path % _count)")
+}
+
+func TestPythonPlotEnv(t *testing.T) {
+	got, err := toLangOpts(Builtin(), Input{Lang: "python", Files: []box.File{{Body: "x"}, {Name: "requirements.txt", Body: "numpy"}}, Manifest: "requirements.txt"})
+	require.NoError(t, err)
+	inst, ok := cache.FindInstaller("python", "requirements.txt")
+	require.True(t, ok)
+	env := addEnv(got.Env, inst.Env("/envs/k")...)
+	require.Equal(t, []string{"MPLBACKEND=module://runbox_plot", "PYTHONPATH=/home/user01:/envs/k/site"}, env)
+	require.Equal(t, []string{"MPLBACKEND=module://runbox_plot", "PYTHONPATH=/home/user01"}, got.Env)
+}
+
+func TestAddEnv(t *testing.T) {
+	env := addEnv([]string{"PYTHONPATH=/a", "LANG=C"}, "PYTHONPATH=/b", "LANG=C.UTF-8", "X=1")
+	require.Equal(t, []string{"PYTHONPATH=/a:/b", "LANG=C", "LANG=C.UTF-8", "X=1"}, env)
+}
@@ -0,0 +1,502 @@
+package lang
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/zetaoss/runbox/pkg/apperror"
+	"github.com/zetaoss/runbox/pkg/runner/box"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed languages.yaml
+var builtinLanguages []byte
+
+type Spec struct {
+	Name    string   `yaml:"name" json:"name"`
+	Aliases []string `yaml:"aliases,omitempty" json:"aliases,omitempty"`
+	// AllowedArgs are patterns that request compiler and runtime flags must
+	// fully match.
+	AllowedArgs AllowedArgs `yaml:"allowedArgs,omitempty" json:"allowedArgs,omitempty"`
+	// Artifacts are files, relative to workingDir, returned after a run.
+	Artifacts          []string `yaml:"artifacts,omitempty" json:"artifacts,omitempty"`
+	CollectImagesCount int      `yaml:"collectImagesCount,omitempty" json:"collectImagesCount,omitempty"`
+	// Command runs the program. {{main}} is the entry file and {{mainClass}}
+	// its Java class name; {{compileArgs}}, {{runtimeArgs}} and {{runArgs}}
+	// take the request's arguments, and latex fills {{engine}}, {{dpi}} and
+	// {{pages}} from its tex options.
+	Command string `yaml:"command" json:"command"`
+	// Compile and Run split Command for the judge, which compiles once and
+	// runs per test case.
+	Compile string `yaml:"compile,omitempty" json:"compile,omitempty"`
+	// Datasets maps a dataset name to its file in the image; an empty value
+	// starts from an empty database.
+	Datasets       map[string]string `yaml:"datasets,omitempty" json:"datasets,omitempty"`
+	DefaultDataset string            `yaml:"defaultDataset,omitempty" json:"defaultDataset,omitempty"`
+	DefaultVersion string            `yaml:"defaultVersion,omitempty" json:"defaultVersion,omitempty"`
+	// Detect identifies the language of a request that omits it.
+	Detect DetectSpec `yaml:"detect,omitempty" json:"detect,omitempty"`
+	// Diagnostics names the parser (gcc, javac, mcs, go) for compiler output.
+	Diagnostics string `yaml:"diagnostics,omitempty" json:"diagnostics,omitempty"`
+	// DiagnosticsFile is an artifact parsed for diagnostics in place of the output.
+	DiagnosticsFile string   `yaml:"diagnosticsFile,omitempty" json:"diagnosticsFile,omitempty"`
+	Env             []string `yaml:"env,omitempty" json:"env,omitempty"`
+	FileDir         string   `yaml:"fileDir,omitempty" json:"fileDir,omitempty"`
+	FileName        string   `yaml:"fileName,omitempty" json:"fileName,omitempty"`
+	FileExt         string   `yaml:"fileExt,omitempty" json:"fileExt,omitempty"`
+	Hooks           []string `yaml:"hooks,omitempty" json:"hooks,omitempty"`
+	Image           string   `yaml:"image,omitempty" json:"image,omitempty"`
+	// MaxImageKB raises the 100KiB limit on each collected image and
+	// MaxImagesKB caps their total.
+	MaxImageKB  int `yaml:"maxImageKB,omitempty" json:"maxImageKB,omitempty"`
+	MaxImagesKB int `yaml:"maxImagesKB,omitempty" json:"maxImagesKB,omitempty"`
+	// MemoryMB raises the memory limit for heavy toolchains.
+	MemoryMB int    `yaml:"memoryMB,omitempty" json:"memoryMB,omitempty"`
+	Run      string `yaml:"run,omitempty" json:"run,omitempty"`
+	Shell    string `yaml:"shell,omitempty" json:"shell,omitempty"`
+	// SQL runs a generated driver script in place of the request's SQL.
+	SQL            SQLSpec `yaml:"sql,omitempty" json:"sql,omitempty"`
+	TimeoutSeconds int     `yaml:"timeoutSeconds,omitempty" json:"timeoutSeconds,omitempty"`
+	User           string  `yaml:"user,omitempty" json:"user,omitempty"`
+	// Versions maps a version to an image tag or sha256 digest; an empty
+	// value uses the version itself as the tag.
+	Versions   map[string]string `yaml:"versions,omitempty" json:"versions,omitempty"`
+	WorkingDir string            `yaml:"workingDir,omitempty" json:"workingDir,omitempty"`
+
+	allowedCompile []*regexp.Regexp
+	allowedRuntime []*regexp.Regexp
+	detectPatterns []*regexp.Regexp
+}
+
+type registryFile struct {
+	Languages []Spec `yaml:"languages" json:"languages"`
+}
+
+// hooks are the source rewrites a spec can opt into; they stay in Go because
+// they are code, not configuration.
+var hooks = map[string]func(*LangOpts) error{
+	"php-autoload": func(opts *LangOpts) error {
+		opts.ModifyMainFunc = func(source string) string {
+			source = strings.TrimLeft(source, " \t\n")
+			if !strings.HasPrefix(source, "<?php") {
+				source = "<?php\nrequire_once('vendor/autoload.php');\n" + source
+			}
+			return source
+		}
+		return nil
+	},
+	"julia-plot":  juliaPlot,
+	"python-plot": pythonPlot,
+	"r-plot":      rPlot,
+	// javascript runs .js files as ES modules unless the request brings its
+	// own package.json.
+	"javascript": func(opts *LangOpts) error {
+		addDefaultFile(opts, "package.json", `{"type": "module"}`)
+		return nil
+	},
+	// typescript compiles with tsc into dist/ as ES modules unless the
+	// request brings its own package.json or tsconfig.json.
+	"typescript": func(opts *LangOpts) error {
+		addDefaultFile(opts, "package.json", `{"type": "module"}`)
+		addDefaultFile(opts, "tsconfig.json", `{
+  "compilerOptions": {
+    "target": "es2022",
+    "module": "nodenext",
+    "moduleResolution": "nodenext",
+    "rootDir": ".",
+    "outDir": "dist",
+    "skipLibCheck": true,
+    "pretty": false
+  },
+  "exclude": ["node_modules", "dist"]
+}`)
+		return nil
+	},
+	// rust switches to cargo, resolving crates from the image's vendored
+	// set, when the request brings a Cargo.toml.
+	"rust-cargo": func(opts *LangOpts) error {
+		if !hasFile(opts, "Cargo.toml") {
+			return nil
+		}
+		if len(opts.Input.CompileArgs) > 0 {
+			return fmt.Errorf("%w: compileArgs not supported with Cargo.toml", apperror.ErrInvalidArgs)
+		}
+		opts.Compile = "cargo build --offline --quiet"
+		opts.Run = expandArgs("cargo run --offline --quiet -- {{runArgs}}", argsRun, opts.Input.RunArgs)
+		opts.Command = opts.Compile + " && " + opts.Run
+		return nil
+	},
+	// latex builds with latexmk, which reruns the engine and bibtex or biber
+	// until references settle, then renders the chosen pages.
+	"latex": func(opts *LangOpts) error {
+		var o TeXOptions
+		if opts.Input.TeX != nil {
+			o = *opts.Input.TeX
+		}
+		var err error
+		if opts.Command, err = texCommand(opts.Command, o); err != nil {
+			return err
+		}
+		opts.Run = opts.Command
+		return nil
+	},
+	// sqlite3 runs scripts that start with a dot-command without -header so
+	// they pick their own output format. The script is only ever read from
+	// the file, never put on the command line.
+	"sqlite3-dot": func(opts *LangOpts) error {
+		if opts.Input.Main >= len(opts.Input.Files) {
+			return nil
+		}
+		if strings.HasPrefix(opts.Input.Files[opts.Input.Main].Body, ".") {
+			opts.Command = "sqlite3 " + sqliteDatabase + " < " + shellWord(opts.FileName+"."+opts.FileExt)
+			opts.Run = opts.Command
+		}
+		return nil
+	},
+}
+
+func hasFile(opts *LangOpts, name string) bool {
+	for _, f := range opts.Input.Files {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func addDefaultFile(opts *LangOpts, name, body string) {
+	if hasFile(opts, name) {
+		return
+	}
+	files := append([]box.File{}, opts.Input.Files...)
+	opts.Input.Files = append(files, box.File{Name: name, Body: body})
+}
+
+var (
+	namePattern    = regexp.MustCompile(`^[a-z0-9][a-z0-9+_-]*$`)
+	imagePattern   = regexp.MustCompile(`^[a-z0-9]+([._/:@-][a-zA-Z0-9_.-]+)*$`)
+	versionPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+	digestPattern  = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+)
+
+const maxTimeoutSeconds = 600
+
+func (s *Spec) setDefaults() {
+	if s.FileName == "" {
+		s.FileName = "runbox"
+	}
+	if s.FileExt == "" {
+		s.FileExt = s.Name
+	}
+	if s.Shell == "" {
+		s.Shell = "sh"
+	}
+	if s.TimeoutSeconds == 0 {
+		s.TimeoutSeconds = 10
+	}
+	if s.WorkingDir == "" {
+		s.WorkingDir = "/home/user01"
+	}
+}
+
+func (s *Spec) validate() error {
+	if !namePattern.MatchString(s.Name) {
+		return fmt.Errorf("invalid name: '%s'", s.Name)
+	}
+	if s.Command == "" {
+		return fmt.Errorf("%s: command is required", s.Name)
+	}
+	if s.Compile != "" && s.Run == "" {
+		return fmt.Errorf("%s: run is required with compile", s.Name)
+	}
+	if s.TimeoutSeconds < 0 || s.TimeoutSeconds > maxTimeoutSeconds {
+		return fmt.Errorf("%s: timeoutSeconds must be between 1 and %d", s.Name, maxTimeoutSeconds)
+	}
+	if s.MaxImageKB < 0 || s.MaxImagesKB < 0 {
+		return fmt.Errorf("%s: maxImageKB and maxImagesKB must not be negative", s.Name)
+	}
+	if s.DiagnosticsFile != "" && !slices.Contains(s.Artifacts, s.DiagnosticsFile) {
+		return fmt.Errorf("%s: diagnosticsFile not in artifacts: '%s'", s.Name, s.DiagnosticsFile)
+	}
+	if s.MemoryMB < 0 {
+		return fmt.Errorf("%s: memoryMB must not be negative", s.Name)
+	}
+	if s.CollectImagesCount < 0 {
+		return fmt.Errorf("%s: collectImagesCount must not be negative", s.Name)
+	}
+	if !path.IsAbs(s.WorkingDir) {
+		return fmt.Errorf("%s: workingDir must be absolute: '%s'", s.Name, s.WorkingDir)
+	}
+	if s.Image != "" && !imagePattern.MatchString(s.Image) {
+		return fmt.Errorf("%s: invalid image: '%s'", s.Name, s.Image)
+	}
+	for _, e := range s.Env {
+		if !strings.Contains(e, "=") {
+			return fmt.Errorf("%s: invalid env: '%s'", s.Name, e)
+		}
+	}
+	for _, h := range s.Hooks {
+		if _, ok := hooks[h]; !ok {
+			return fmt.Errorf("%s: unknown hook: '%s'", s.Name, h)
+		}
+	}
+	if _, ok := diagnosticParsers[s.Diagnostics]; s.Diagnostics != "" && !ok {
+		return fmt.Errorf("%s: unknown diagnostics parser: '%s'", s.Name, s.Diagnostics)
+	}
+	for v, ref := range s.Versions {
+		if !versionPattern.MatchString(v) {
+			return fmt.Errorf("%s: invalid version: '%s'", s.Name, v)
+		}
+		if ref != "" && !versionPattern.MatchString(ref) && !digestPattern.MatchString(ref) {
+			return fmt.Errorf("%s: invalid tag or digest for version %s: '%s'", s.Name, v, ref)
+		}
+	}
+	if _, ok := s.Versions[s.DefaultVersion]; s.DefaultVersion != "" && !ok {
+		return fmt.Errorf("%s: defaultVersion not in versions: '%s'", s.Name, s.DefaultVersion)
+	}
+	if len(s.Datasets) > 0 {
+		if _, ok := sqlDialects[s.SQL.Dialect]; !ok {
+			return fmt.Errorf("%s: datasets require sql.dialect", s.Name)
+		}
+		for name := range s.Datasets {
+			if !namePattern.MatchString(name) {
+				return fmt.Errorf("%s: invalid dataset: '%s'", s.Name, name)
+			}
+		}
+	}
+	if _, ok := s.Datasets[s.DefaultDataset]; s.DefaultDataset != "" && !ok {
+		return fmt.Errorf("%s: defaultDataset not in datasets: '%s'", s.Name, s.DefaultDataset)
+	}
+	var err error
+	if s.allowedCompile, err = compileAllowed(s.AllowedArgs.Compile); err != nil {
+		return fmt.Errorf("%s: invalid allowedArgs.compile: %w", s.Name, err)
+	}
+	if s.allowedRuntime, err = compileAllowed(s.AllowedArgs.Runtime); err != nil {
+		return fmt.Errorf("%s: invalid allowedArgs.runtime: %w", s.Name, err)
+	}
+	if s.detectPatterns, err = compileDetect(s.Detect.Patterns); err != nil {
+		return fmt.Errorf("%s: invalid detect.patterns: %w", s.Name, err)
+	}
+	return nil
+}
+
+// resolve picks the image for a requested version, falling back to the
+// default version. It returns the version actually used.
+func (s Spec) resolve(version string) (string, string, error) {
+	image := s.Image
+	if image == "" {
+		image = Image(s.Name)
+	}
+	if version == "" {
+		version = s.DefaultVersion
+	}
+	if version == "" {
+		return image, "", nil
+	}
+	ref, ok := s.Versions[version]
+	if !ok {
+		return "", "", apperror.ErrInvalidVersion
+	}
+	image = imageRepo(image)
+	switch {
+	case ref == "":
+		return image + ":" + version, version, nil
+	case digestPattern.MatchString(ref):
+		return image + "@" + ref, version, nil
+	default:
+		return image + ":" + ref, version, nil
+	}
+}
+
+// imageRepo strips the tag or digest from an image reference.
+func imageRepo(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
+
+type Registry struct {
+	mu      sync.RWMutex
+	path    string
+	specs   map[string]Spec
+	aliases map[string]string
+}
+
+// Builtin returns a registry holding the languages shipped with runbox.
+func Builtin() *Registry {
+	r := &Registry{}
+	if err := r.Load(builtinLanguages); err != nil {
+		panic(fmt.Sprintf("builtin languages: %v", err))
+	}
+	return r
+}
+
+// LoadRegistry reads a registry file. Reload re-reads the same file.
+func LoadRegistry(name string) (*Registry, error) {
+	r := &Registry{path: name}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Registry) Reload() error {
+	if r.path == "" {
+		return r.Load(builtinLanguages)
+	}
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return err
+	}
+	return r.Load(data)
+}
+
+// Load validates YAML or JSON registry data and swaps it in only when valid.
+func (r *Registry) Load(data []byte) error {
+	var f registryFile
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil {
+		return fmt.Errorf("yaml.Decode err: %w", err)
+	}
+	if len(f.Languages) == 0 {
+		return fmt.Errorf("no languages")
+	}
+	specs := map[string]Spec{}
+	aliases := map[string]string{}
+	for _, s := range f.Languages {
+		s.setDefaults()
+		if err := s.validate(); err != nil {
+			return err
+		}
+		for _, name := range append([]string{s.Name}, s.Aliases...) {
+			if !namePattern.MatchString(name) {
+				return fmt.Errorf("%s: invalid alias: '%s'", s.Name, name)
+			}
+			if _, ok := aliases[name]; ok {
+				return fmt.Errorf("duplicate language: '%s'", name)
+			}
+			aliases[name] = s.Name
+		}
+		specs[s.Name] = s
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.specs = specs
+	r.aliases = aliases
+	return nil
+}
+
+// Lookup resolves a language name or alias to its spec.
+func (r *Registry) Lookup(lang string) (Spec, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.specs[r.aliases[strings.ToLower(lang)]]
+	return s, ok
+}
+
+// Names lists the canonical language names.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.specs))
+	for name := range r.specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Image returns the image a language runs with by default.
+func (r *Registry) Image(lang string) string {
+	s, ok := r.Lookup(lang)
+	if !ok {
+		return Image(lang)
+	}
+	image, _, _ := s.resolve("")
+	return image
+}
+
+// Version returns the version a request for lang and version runs with.
+func (r *Registry) Version(lang, version string) string {
+	s, ok := r.Lookup(lang)
+	if !ok {
+		return ""
+	}
+	_, v, _ := s.resolve(version)
+	return v
+}
+
+func (s Spec) langOpts(input Input) (*LangOpts, error) {
+	image, version, err := s.resolve(input.Version)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkArgs(argsCompile, input.CompileArgs, s.allowedCompile); err != nil {
+		return nil, err
+	}
+	if err := s.checkArgs(argsRuntime, input.RuntimeArgs, s.allowedRuntime); err != nil {
+		return nil, err
+	}
+	if err := s.checkArgs(argsRun, input.RunArgs, nil); err != nil {
+		return nil, err
+	}
+	if input.TeX != nil && !slices.Contains(s.Hooks, "latex") {
+		return nil, fmt.Errorf("%w: tex options not supported for %s", apperror.ErrInvalidArgs, s.Name)
+	}
+	if err := checkPlot(s, input); err != nil {
+		return nil, err
+	}
+	if err := s.checkFiles(input); err != nil {
+		return nil, err
+	}
+	main, entry, err := s.entry(input)
+	if err != nil {
+		return nil, err
+	}
+	input.Lang = s.Name
+	input.Version = version
+	input.Main = main
+	opts := &LangOpts{
+		Input:              input,
+		Artifacts:          s.Artifacts,
+		Command:            s.expand(s.Command, input, entry),
+		Compile:            s.expand(s.Compile, input, entry),
+		CollectImagesCount: s.CollectImagesCount,
+		Env:                append([]string(nil), s.Env...),
+		FileDir:            s.FileDir,
+		FileName:           s.FileName,
+		FileExt:            s.FileExt,
+		Image:              image,
+		MaxImageKB:         s.MaxImageKB,
+		MaxImagesKB:        s.MaxImagesKB,
+		MemoryMB:           s.MemoryMB,
+		Run:                s.expand(s.Run, input, entry),
+		Shell:              s.Shell,
+		TimeoutSeconds:     s.TimeoutSeconds,
+		User:               s.User,
+		WorkingDir:         s.WorkingDir,
+	}
+	if opts.Run == "" {
+		opts.Run = opts.Command
+	}
+	for _, h := range s.Hooks {
+		if err := hooks[h](opts); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.applyDataset(opts); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
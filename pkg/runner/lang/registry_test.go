@@ -0,0 +1,206 @@
+package lang
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zetaoss/runbox/pkg/runner/box"
+	"github.com/zetaoss/runbox/pkg/testutil"
+)
+
+func TestBuiltin(t *testing.T) {
+	r := Builtin()
+	require.Equal(t, []string{
+		"bash", "c", "cpp", "csharp", "go", "haskell", "java", "javascript", "julia", "kotlin", "latex", "lua", "mysql",
+		"perl", "php", "powershell", "python", "r", "ruby", "rust", "sqlite3", "swift", "typescript", "zig",
+	}, r.Names())
+
+	testCases := []struct {
+		lang      string
+		wantName  string
+		wantImage string
+	}{
+		{"latex", "latex", "ghcr.io/zetaoss/runcontainers/latex:latest"},
+		{"tex", "latex", "ghcr.io/zetaoss/runcontainers/latex:latest"},
+		{"py", "python", "ghcr.io/zetaoss/runcontainers/python:latest"},
+		{"golang", "go", "ghcr.io/zetaoss/runcontainers/go:latest"},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.lang), func(t *testing.T) {
+			s, ok := r.Lookup(tc.lang)
+			require.True(t, ok)
+			require.Equal(t, tc.wantName, s.Name)
+			require.Equal(t, tc.wantImage, r.Image(tc.lang))
+		})
+	}
+	_, ok := r.Lookup("cobol")
+	require.False(t, ok)
+}
+
+func TestRegistry_Load(t *testing.T) {
+	testCases := []struct {
+		data      string
+		wantError string
+	}{
+		{"languages:\n- name: awk\n  command: awk -f runbox.awk\n  image: example.com/awk:1\n", ""},
+		{`{"languages":[{"name":"awk","command":"awk -f runbox.awk"}]}`, ""},
+		{"languages: []\n", "no languages"},
+		{"languages:\n- name: awk\n", "awk: command is required"},
+		{"languages:\n- name: Awk\n  command: x\n", "invalid name: 'Awk'"},
+		{"languages:\n- name: awk\n  command: x\n  timeoutSeconds: 601\n", "awk: timeoutSeconds must be between 1 and 600"},
+		{"languages:\n- name: awk\n  command: x\n  workingDir: tmp\n", "awk: workingDir must be absolute: 'tmp'"},
+		{"languages:\n- name: awk\n  command: x\n  hooks: [nope]\n", "awk: unknown hook: 'nope'"},
+		{"languages:\n- name: awk\n  command: x\n  env: [A]\n", "awk: invalid env: 'A'"},
+		{"languages:\n- name: awk\n  command: x\n  image: 'a b'\n", "awk: invalid image: 'a b'"},
+		{"languages:\n- name: awk\n  command: x\n- name: gawk\n  aliases: [awk]\n  command: x\n", "duplicate language: 'awk'"},
+		{"languages:\n- name: awk\n  command: x\n  datasets: {a: a.db}\n", "awk: datasets require sql.dialect"},
+		{"languages:\n- name: awk\n  command: x\n  sql: {dialect: sqlite3}\n  datasets: {a: a.db}\n  defaultDataset: b\n", "awk: defaultDataset not in datasets: 'b'"},
+		{"languages:\n- name: awk\n  command: x\n  extension: awk\n", "yaml.Decode err: yaml: unmarshal errors:\n  line 4: field extension not found in type lang.Spec"},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i), func(t *testing.T) {
+			err := (&Registry{}).Load([]byte(tc.data))
+			if tc.wantError == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tc.wantError)
+			}
+		})
+	}
+}
+
+func TestRegistry_Reload(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "languages.yaml")
+	require.NoError(t, os.WriteFile(name, []byte("languages:\n- name: awk\n  command: awk -f runbox.awk\n"), 0o644))
+	r, err := LoadRegistry(name)
+	require.NoError(t, err)
+	require.Equal(t, []string{"awk"}, r.Names())
+
+	require.NoError(t, os.WriteFile(name, []byte("languages:\n- name: awk\n"), 0o644))
+	require.EqualError(t, r.Reload(), "awk: command is required")
+	require.Equal(t, []string{"awk"}, r.Names())
+
+	require.NoError(t, os.WriteFile(name, []byte("languages:\n- name: awk\n  command: x\n  aliases: [gawk]\n"), 0o644))
+	require.NoError(t, r.Reload())
+	s, ok := r.Lookup("gawk")
+	require.True(t, ok)
+	require.Equal(t, "x", s.Command)
+}
+
+func TestRegistry_Version(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("ab", 32)
+	r := &Registry{}
+	require.NoError(t, r.Load([]byte(`languages:
+- name: python
+  command: python runbox.py
+  defaultVersion: "3.12"
+  versions: {"3.12": "", "3.9": "3.9-slim", "3.8": "`+digest+`"}
+- name: lua
+  command: lua runbox.lua
+- name: awk
+  command: awk -f runbox.awk
+  image: example.com/awk:1
+  versions: {"2": ""}
+`)))
+	testCases := []struct {
+		lang        string
+		version     string
+		wantImage   string
+		wantVersion string
+		wantError   string
+	}{
+		{"python", "", "ghcr.io/zetaoss/runcontainers/python:3.12", "3.12", ""},
+		{"python", "3.9", "ghcr.io/zetaoss/runcontainers/python:3.9-slim", "3.9", ""},
+		{"python", "3.8", "ghcr.io/zetaoss/runcontainers/python@" + digest, "3.8", ""},
+		{"python", "2.7", "", "", "invalid version"},
+		{"lua", "", "ghcr.io/zetaoss/runcontainers/lua", "", ""},
+		{"lua", "5.4", "", "", "invalid version"},
+		{"awk", "", "example.com/awk:1", "", ""},
+		{"awk", "2", "example.com/awk:2", "2", ""},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.lang, tc.version), func(t *testing.T) {
+			got, err := toLangOpts(r, Input{Lang: tc.lang, Version: tc.version, Files: []box.File{{Body: "x"}}})
+			if tc.wantError != "" {
+				require.EqualError(t, err, tc.wantError)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.wantImage, got.Image)
+			require.Equal(t, tc.wantVersion, got.Input.Version)
+			require.Equal(t, tc.wantVersion, r.Version(tc.lang, tc.version))
+		})
+	}
+	require.Equal(t, "ghcr.io/zetaoss/runcontainers/python:3.12", r.Image("python"))
+
+	err := (&Registry{}).Load([]byte("languages:\n- name: lua\n  command: x\n  defaultVersion: '5.4'\n"))
+	require.EqualError(t, err, "lua: defaultVersion not in versions: '5.4'")
+	err = (&Registry{}).Load([]byte("languages:\n- name: lua\n  command: x\n  versions: {'5.4': 'a b'}\n"))
+	require.EqualError(t, err, "lua: invalid tag or digest for version 5.4: 'a b'")
+}
+
+func TestJavascriptHook(t *testing.T) {
+	got, err := toLangOpts(Builtin(), Input{Lang: "js", Files: []box.File{{Body: "console.log(1)"}}})
+	require.NoError(t, err)
+	require.Equal(t, []box.File{{Body: "console.log(1)"}, {Name: "package.json", Body: `{"type": "module"}`}}, got.Input.Files)
+
+	files := []box.File{{Body: "x"}, {Name: "package.json", Body: `{"type": "commonjs"}`}}
+	got, err = toLangOpts(Builtin(), Input{Lang: "javascript", Files: files})
+	require.NoError(t, err)
+	require.Equal(t, files, got.Input.Files)
+}
+
+func TestTypescriptHook(t *testing.T) {
+	got, err := toLangOpts(Builtin(), Input{Lang: "ts", Files: []box.File{{Body: "console.log(1)"}}})
+	require.NoError(t, err)
+	require.Len(t, got.Input.Files, 3)
+	require.Equal(t, "package.json", got.Input.Files[1].Name)
+	require.Equal(t, "tsconfig.json", got.Input.Files[2].Name)
+	require.Contains(t, got.Input.Files[2].Body, `"outDir": "dist"`)
+
+	files := []box.File{{Body: "x"}, {Name: "package.json", Body: `{"type": "commonjs"}`}}
+	got, err = toLangOpts(Builtin(), Input{Lang: "typescript", Files: files})
+	require.NoError(t, err)
+	require.Len(t, got.Input.Files, 3)
+	require.Equal(t, `{"type": "commonjs"}`, got.Input.Files[1].Body)
+	require.Len(t, files, 2)
+}
+
+func TestRustCargoHook(t *testing.T) {
+	files := []box.File{{Name: "Cargo.toml", Body: "[package]"}, {Name: "src/main.rs", Body: "fn main() {}"}}
+	got, err := toLangOpts(Builtin(), Input{Lang: "rust", Files: files, RunArgs: []string{"a b"}})
+	require.NoError(t, err)
+	require.Equal(t, "cargo build --offline --quiet", got.Compile)
+	require.Equal(t, "cargo run --offline --quiet -- 'a b'", got.Run)
+	require.Equal(t, 2048, got.MemoryMB)
+
+	_, err = toLangOpts(Builtin(), Input{Lang: "rust", Files: files, CompileArgs: []string{"-O"}})
+	require.EqualError(t, err, "invalid args: compileArgs not supported with Cargo.toml")
+
+	got, err = toLangOpts(Builtin(), Input{Lang: "rs", Files: []box.File{{Body: "fn main() {}"}}, CompileArgs: []string{"-O"}})
+	require.NoError(t, err)
+	require.Equal(t, "rustc --edition=2021 '-O' -o runbox.bin runbox.rs", got.Compile)
+	require.Equal(t, int64(2048)<<20, toBoxOpts(*got).Memory)
+}
+
+func TestSqlite3DotHook(t *testing.T) {
+	testCases := []string{
+		".tables",
+		".tables; touch /tmp/pwned",
+		".tables\n$(id)`id`",
+		".shell id",
+		".tables' && id '",
+	}
+	for i, source := range testCases {
+		t.Run(testutil.Name(i, source), func(t *testing.T) {
+			got, err := toLangOpts(Builtin(), Input{Lang: "sqlite3", Files: []box.File{{Body: source}}})
+			require.NoError(t, err)
+			opts := toBoxOpts(*got)
+			require.Equal(t, "cp chinook.db /tmp/runbox.db && sqlite3 /tmp/runbox.db < runbox.sql", opts.Command)
+			require.Equal(t, []box.File{{Name: "/home/user01/runbox.sql", Body: source}}, opts.Files)
+		})
+	}
+}
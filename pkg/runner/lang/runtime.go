@@ -0,0 +1,66 @@
+package lang
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+type RuntimeConfig struct {
+	Default string            `json:"default,omitempty"`
+	Langs   map[string]string `json:"langs,omitempty"`
+	Tenants map[string]string `json:"tenants,omitempty"`
+	// Keys maps each API key to the tenant it authenticates.
+	Keys map[string]string `json:"keys,omitempty"`
+}
+
+func LoadRuntimeConfig(name string) (*RuntimeConfig, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var c RuntimeConfig
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal err: %w", err)
+	}
+	return &c, nil
+}
+
+func (c *RuntimeConfig) Validate(hasRuntime func(string) bool) error {
+	names := []string{c.Default}
+	for _, name := range c.Langs {
+		names = append(names, name)
+	}
+	for _, name := range c.Tenants {
+		names = append(names, name)
+	}
+	for _, name := range names {
+		if !hasRuntime(name) {
+			return fmt.Errorf("runtime not available: '%s'", name)
+		}
+	}
+	return nil
+}
+
+// Tenant returns the tenant an API key belongs to, or "" for unknown keys.
+func (c *RuntimeConfig) Tenant(key string) string {
+	if c == nil || key == "" {
+		return ""
+	}
+	return c.Keys[key]
+}
+
+// Resolve picks the runtime for a run. A tenant override wins over a language
+// one, so the tenant must come from Tenant and never from the request.
+func (c *RuntimeConfig) Resolve(lang, tenant string) string {
+	if c == nil {
+		return ""
+	}
+	if name, ok := c.Tenants[tenant]; ok && tenant != "" {
+		return name
+	}
+	if name, ok := c.Langs[lang]; ok {
+		return name
+	}
+	return c.Default
+}
@@ -0,0 +1,53 @@
+package lang
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zetaoss/runbox/pkg/runner/box"
+	"github.com/zetaoss/runbox/pkg/testutil"
+)
+
+func TestRuntimeConfig_Resolve(t *testing.T) {
+	c := &RuntimeConfig{
+		Default: "runc",
+		Langs:   map[string]string{"python": "runsc"},
+		Tenants: map[string]string{"public": "kata"},
+	}
+	testCases := []struct {
+		config *RuntimeConfig
+		lang   string
+		tenant string
+		want   string
+	}{
+		{nil, "python", "public", ""},
+		{c, "bash", "", "runc"},
+		{c, "python", "", "runsc"},
+		{c, "python", "public", "kata"},
+		{c, "bash", "internal", "runc"},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.lang, tc.tenant), func(t *testing.T) {
+			require.Equal(t, tc.want, tc.config.Resolve(tc.lang, tc.tenant))
+		})
+	}
+}
+
+func TestRuntimeConfig_Tenant(t *testing.T) {
+	c := &RuntimeConfig{Keys: map[string]string{"k1": "public"}}
+	require.Equal(t, "public", c.Tenant("k1"))
+	require.Equal(t, "", c.Tenant("public"))
+	require.Equal(t, "", c.Tenant(""))
+	require.Equal(t, "", (*RuntimeConfig)(nil).Tenant("k1"))
+}
+
+func TestRuntimeConfig_Validate(t *testing.T) {
+	available := map[string]bool{"": true, "runc": true, "runsc": true}
+	hasRuntime := func(name string) bool { return available[name] }
+
+	require.NoError(t, (&RuntimeConfig{Langs: map[string]string{"python": "runsc"}}).Validate(hasRuntime))
+	require.EqualError(t, (&RuntimeConfig{Tenants: map[string]string{"public": "kata"}}).Validate(hasRuntime), "runtime not available: 'kata'")
+
+	unprobed := box.New(nil)
+	require.EqualError(t, (&RuntimeConfig{Default: "runsc"}).Validate(unprobed.HasRuntime), "runtime not available: 'runsc'")
+}
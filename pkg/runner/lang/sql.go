@@ -0,0 +1,530 @@
+package lang
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zetaoss/runbox/pkg/apperror"
+	"github.com/zetaoss/runbox/pkg/runner/box"
+)
+
+const (
+	dialectMySQL   = "mysql"
+	dialectSQLite3 = "sqlite3"
+
+	maxSQLStatements = 1000
+)
+
+// SQLSpec runs a generated driver script in place of the request's SQL so
+// results come back per statement.
+type SQLSpec struct {
+	Dialect string `yaml:"dialect" json:"dialect"`
+	Command string `yaml:"command" json:"command"`
+}
+
+type SQLResult struct {
+	Statements []SQLStatement `json:"statements"`
+}
+
+type SQLStatement struct {
+	SQL      string      `json:"sql"`
+	Columns  []SQLColumn `json:"columns,omitempty"`
+	Rows     [][]any     `json:"rows,omitempty"`
+	Affected int64       `json:"affected"`
+	Time     float64     `json:"time"` // ms
+	Error    string      `json:"error,omitempty"`
+	Output   []string    `json:"output,omitempty"`
+}
+
+type SQLColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type,omitempty"`
+}
+
+type sqlDialect struct {
+	script func(nonce string, stmts []string) string
+	parse  func(nonce string, stmts []string, lines []string) (*SQLResult, []string)
+	files  []box.File
+}
+
+var sqlDialects = map[string]sqlDialect{
+	dialectSQLite3: {script: sqliteScript, parse: parseSQLite},
+	// The mysql client reads its options from ~/.my.cnf whichever way the
+	// image invokes it.
+	dialectMySQL: {
+		script: mysqlScript,
+		parse:  parseMySQL,
+		files:  []box.File{{Name: ".my.cnf", Body: "[mysql]\nbatch\ncolumn-type-info\nforce\nunbuffered\n"}},
+	},
+}
+
+// RunSQL runs the main SQL file statement by statement and returns each
+// statement's columns, rows, affected row count, time and error.
+func (l *Lang) RunSQL(input Input, runOpts box.RunOptions) (*box.Result, *SQLResult, error) {
+	langOpts, err := l.langOpts(input)
+	if err != nil {
+		return nil, nil, err
+	}
+	spec, _ := l.registry.Lookup(langOpts.Input.Lang)
+	dialect, ok := sqlDialects[spec.SQL.Dialect]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: sql results for %s", apperror.ErrUnsupported, spec.Name)
+	}
+	var sources []string
+	var files []box.File
+	for _, f := range langOpts.Input.Files {
+		if f.Name == "" || f.Name == spec.mainName() {
+			sources = append(sources, f.Body)
+			continue
+		}
+		files = append(files, f)
+	}
+	stmts := splitSQL(strings.Join(sources, "\n"), spec.SQL.Dialect)
+	if len(stmts) > maxSQLStatements {
+		return nil, nil, fmt.Errorf("%w: too many statements", apperror.ErrUnsupported)
+	}
+	nonce, err := newNonce("@sql-")
+	if err != nil {
+		return nil, nil, fmt.Errorf("newNonce err: %w", err)
+	}
+	files = append(files, dialect.files...)
+	langOpts.Input.Files = append(files, box.File{Body: dialect.script(nonce, stmts)})
+	langOpts.Input.Main = len(langOpts.Input.Files) - 1
+	langOpts.Command = spec.SQL.Command
+	if len(dialect.files) > 0 {
+		langOpts.Env = append(langOpts.Env, "HOME="+langOpts.WorkingDir)
+	}
+	boxOpts := toBoxOpts(*langOpts)
+	boxOpts.CollectImages = false
+	boxOpts.Tty = false
+	boxOpts.Base64Binary = false
+	boxOpts.OutputEncoding = ""
+	// The driver's lines carry nonces and are parsed first, so they are
+	// not streamed.
+	runOpts.Sink = nil
+	if err := runOpts.Apply(&boxOpts, l.box.Limits()); err != nil {
+		return nil, nil, err
+	}
+	result, err := l.box.Run(&boxOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+	lines := make([]string, len(result.Logs))
+	for i, log := range result.Logs {
+		lines[i] = log.Log
+	}
+	sqlResult, rest := dialect.parse(nonce, stmts, lines)
+	// Only what the driver did not account for, such as server start-up
+	// errors, is left in the logs.
+	var logs []box.Log
+	for _, line := range rest {
+		logs = append(logs, box.Log{Stream: 1, Log: line})
+	}
+	result.Logs = logs
+	return result, sqlResult, nil
+}
+
+var delimiterPattern = regexp.MustCompile(`(?i)^\s*delimiter\s+(\S+)\s*$`)
+
+// splitSQL splits a script into statements without their delimiters. It
+// knows quotes and comments, sqlite3 dot commands and trigger bodies, and
+// the mysql DELIMITER command.
+func splitSQL(source, dialect string) []string {
+	var stmts []string
+	var b strings.Builder
+	hasCode := false
+	depth := 0
+	delim := ";"
+	flush := func() {
+		if hasCode {
+			stmts = append(stmts, strings.TrimSpace(b.String()))
+		}
+		b.Reset()
+		hasCode = false
+		depth = 0
+	}
+	for i := 0; i < len(source); {
+		lineStart := i == 0 || source[i-1] == '\n'
+		if lineStart && !hasCode {
+			line, _, _ := strings.Cut(source[i:], "\n")
+			if dialect == dialectSQLite3 && strings.HasPrefix(strings.TrimSpace(line), ".") {
+				b.Reset()
+				stmts = append(stmts, strings.TrimSpace(line))
+				i += len(line) + 1
+				continue
+			}
+			if m := delimiterPattern.FindStringSubmatch(line); dialect == dialectMySQL && m != nil {
+				delim = m[1]
+				i += len(line) + 1
+				continue
+			}
+		}
+		c := source[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for j < len(source) {
+				if source[j] == '\\' && dialect == dialectMySQL {
+					j += 2
+					continue
+				}
+				if source[j] == c {
+					if j+1 < len(source) && source[j+1] == c {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			j = min(j+1, len(source))
+			b.WriteString(source[i:j])
+			hasCode = true
+			i = j
+		case strings.HasPrefix(source[i:], "--") || c == '#' && dialect == dialectMySQL:
+			line, _, _ := strings.Cut(source[i:], "\n")
+			b.WriteString(line)
+			i += len(line)
+		case strings.HasPrefix(source[i:], "/*"):
+			end := strings.Index(source[i+2:], "*/")
+			j := len(source)
+			if end >= 0 {
+				j = i + 2 + end + 2
+			}
+			b.WriteString(source[i:j])
+			i = j
+		case depth == 0 && strings.HasPrefix(source[i:], delim):
+			flush()
+			i += len(delim)
+		case isWordByte(c) && (i == 0 || !isWordByte(source[i-1])):
+			j := i
+			for j < len(source) && isWordByte(source[j]) {
+				j++
+			}
+			switch word := strings.ToUpper(source[i:j]); {
+			case dialect != dialectSQLite3:
+			case word != "BEGIN" && word != "CASE" && word != "END":
+			case !triggerPattern.MatchString(b.String()):
+			case word == "END":
+				depth = max(depth-1, 0)
+			default:
+				depth++
+			}
+			b.WriteString(source[i:j])
+			hasCode = true
+			i = j
+		default:
+			b.WriteByte(c)
+			if c > ' ' {
+				hasCode = true
+			}
+			i++
+		}
+	}
+	flush()
+	return stmts
+}
+
+var triggerPattern = regexp.MustCompile(`(?is)^\s*(?:--[^\n]*\n\s*)*CREATE\s+(?:TEMP\s+|TEMPORARY\s+)?TRIGGER\b`)
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func sqliteScript(nonce string, stmts []string) string {
+	var b strings.Builder
+	changes := func(i int) {
+		fmt.Fprintf(&b, ".timer off\n.headers off\n.mode list\nSELECT '%s changes %d ' || total_changes();\n", nonce, i)
+	}
+	b.WriteString(".bail off\n")
+	changes(-1)
+	for i, s := range stmts {
+		fmt.Fprintf(&b, ".print %s stmt %d\n.mode json\n.timer on\n", nonce, i)
+		if strings.HasPrefix(s, ".") {
+			b.WriteString(s + "\n")
+		} else {
+			b.WriteString(s + "\n;\n")
+		}
+		changes(i)
+	}
+	return b.String()
+}
+
+var (
+	sqliteTimePattern  = regexp.MustCompile(`^Run Time: real ([0-9.]+)`)
+	sqliteErrorPattern = regexp.MustCompile(`^(Parse error|Runtime error|Error)\b`)
+	// Line numbers point into the driver script, not the request.
+	sqliteLinePattern = regexp.MustCompile(`^(Parse error|Runtime error|Error):? near line \d+:`)
+)
+
+func parseSQLite(nonce string, stmts []string, lines []string) (*SQLResult, []string) {
+	result := &SQLResult{Statements: make([]SQLStatement, len(stmts))}
+	for i, s := range stmts {
+		result.Statements[i].SQL = s
+	}
+	var rest []string
+	var total int64
+	cur := -1
+	var jsonText strings.Builder
+	inError := false
+	for _, line := range lines {
+		if marker, ok := strings.CutPrefix(line, nonce+" "); ok {
+			fields := strings.Fields(marker)
+			if len(fields) < 2 {
+				continue
+			}
+			i, err := strconv.Atoi(fields[1])
+			if err != nil || i >= len(stmts) {
+				continue
+			}
+			switch fields[0] {
+			case "stmt":
+				cur = i
+				inError = false
+				jsonText.Reset()
+			case "changes":
+				if len(fields) < 3 {
+					continue
+				}
+				n, _ := strconv.ParseInt(fields[2], 10, 64)
+				if i >= 0 {
+					st := &result.Statements[i]
+					st.Affected = n - total
+					if jsonText.Len() > 0 {
+						st.Columns, st.Rows = decodeSQLiteRows(jsonText.String())
+						if st.Columns == nil {
+							st.Output = append(st.Output, jsonText.String())
+						}
+					}
+					jsonText.Reset()
+				}
+				total = n
+				cur = -1
+			}
+			continue
+		}
+		if cur < 0 {
+			rest = append(rest, line)
+			continue
+		}
+		st := &result.Statements[cur]
+		switch m := sqliteTimePattern.FindStringSubmatch(line); {
+		case m != nil:
+			secs, _ := strconv.ParseFloat(m[1], 64)
+			st.Time += secs * 1000
+		case sqliteErrorPattern.MatchString(line):
+			inError = true
+			st.Error = joinLine(st.Error, sqliteLinePattern.ReplaceAllString(line, "$1:"))
+		case inError:
+			st.Error = joinLine(st.Error, line)
+		case jsonText.Len() > 0 || strings.HasPrefix(line, "[{"):
+			jsonText.WriteString(line + "\n")
+		default:
+			st.Output = append(st.Output, line)
+		}
+	}
+	return result, rest
+}
+
+func joinLine(s, line string) string {
+	if s == "" {
+		return line
+	}
+	return s + "\n" + line
+}
+
+// decodeSQLiteRows reads `.mode json` output, keeping the column order that
+// a map would lose. Column types are the storage classes of the first
+// non-null values.
+func decodeSQLiteRows(text string) ([]SQLColumn, [][]any) {
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+	if t, err := dec.Token(); err != nil || t != json.Delim('[') {
+		return nil, nil
+	}
+	var columns []SQLColumn
+	var rows [][]any
+	for dec.More() {
+		if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+			return nil, nil
+		}
+		var row []any
+		for j := 0; dec.More(); j++ {
+			t, err := dec.Token()
+			if err != nil {
+				return nil, nil
+			}
+			var v any
+			if err := dec.Decode(&v); err != nil {
+				return nil, nil
+			}
+			if len(rows) == 0 {
+				columns = append(columns, SQLColumn{Name: fmt.Sprint(t)})
+			}
+			if j < len(columns) && columns[j].Type == "" {
+				columns[j].Type = sqliteType(v)
+			}
+			row = append(row, v)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, nil
+		}
+		rows = append(rows, row)
+	}
+	return columns, rows
+}
+
+func sqliteType(v any) string {
+	switch v := v.(type) {
+	case json.Number:
+		if strings.ContainsAny(v.String(), ".eE") {
+			return "REAL"
+		}
+		return "INTEGER"
+	case string:
+		return "TEXT"
+	}
+	return ""
+}
+
+func mysqlScript(nonce string, stmts []string) string {
+	delim := "$$" + strings.TrimPrefix(nonce, "@sql-")
+	var b strings.Builder
+	fmt.Fprintf(&b, "DELIMITER %s\n", delim)
+	for i, s := range stmts {
+		fmt.Fprintf(&b, "SELECT CONCAT('%s stmt %d ', UNIX_TIMESTAMP(NOW(6))) AS `%s`%s\n", nonce, i, nonce, delim)
+		fmt.Fprintf(&b, "%s\n%s\n", s, delim)
+		fmt.Fprintf(&b, "SELECT CONCAT('%s done %d ', ROW_COUNT(), ' ', UNIX_TIMESTAMP(NOW(6))) AS `%s`%s\n", nonce, i, nonce, delim)
+	}
+	return b.String()
+}
+
+var (
+	mysqlFieldPattern = regexp.MustCompile("^Field\\s+\\d+:\\s+`(.*)`$")
+	mysqlMetaPattern  = regexp.MustCompile(`^([A-Za-z_]+):\s*(.*)$`)
+	mysqlNumericTypes = map[string]bool{
+		"TINY": true, "SHORT": true, "LONG": true, "LONGLONG": true, "INT24": true,
+		"FLOAT": true, "DOUBLE": true, "DECIMAL": true, "NEWDECIMAL": true, "YEAR": true,
+	}
+)
+
+func parseMySQL(nonce string, stmts []string, lines []string) (*SQLResult, []string) {
+	result := &SQLResult{Statements: make([]SQLStatement, len(stmts))}
+	for i, s := range stmts {
+		result.Statements[i].SQL = s
+	}
+	var rest, region []string
+	cur := -1
+	var start float64
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) >= 4 && fields[0] == nonce {
+			i, err := strconv.Atoi(fields[2])
+			if err != nil || i < 0 || i >= len(stmts) {
+				continue
+			}
+			switch {
+			case fields[1] == "stmt":
+				start, _ = strconv.ParseFloat(fields[3], 64)
+				cur = i
+				region = nil
+			case fields[1] == "done" && len(fields) == 5 && i == cur:
+				st := &result.Statements[i]
+				st.Affected, _ = strconv.ParseInt(fields[3], 10, 64)
+				st.Affected = max(st.Affected, 0)
+				end, _ := strconv.ParseFloat(fields[4], 64)
+				st.Time = (end - start) * 1000
+				parseMySQLOutput(st, nonce, region)
+				cur = -1
+			}
+			continue
+		}
+		if cur < 0 {
+			// Column info and headers of the driver's own queries.
+			if !strings.Contains(line, nonce) && !mysqlMetaPattern.MatchString(line) && line != "" {
+				rest = append(rest, line)
+			}
+			continue
+		}
+		region = append(region, line)
+	}
+	return result, rest
+}
+
+// parseMySQLOutput reads batch output with column info: a block per column,
+// a header line and tab-separated rows.
+func parseMySQLOutput(st *SQLStatement, nonce string, lines []string) {
+	// The next marker query's column info ends the statement's output.
+	for i, line := range lines {
+		if strings.Contains(line, "`"+nonce+"`") {
+			lines = lines[:i]
+			break
+		}
+	}
+	header := false
+	for _, line := range lines {
+		if strings.HasPrefix(line, "ERROR ") {
+			st.Error = joinLine(st.Error, line)
+			continue
+		}
+		if m := mysqlFieldPattern.FindStringSubmatch(line); m != nil {
+			if header {
+				break // only the first result set
+			}
+			st.Columns = append(st.Columns, SQLColumn{Name: m[1]})
+			continue
+		}
+		if !header && len(st.Columns) > 0 {
+			if m := mysqlMetaPattern.FindStringSubmatch(line); m != nil {
+				if m[1] == "Type" {
+					st.Columns[len(st.Columns)-1].Type = m[2]
+				}
+				continue
+			}
+			if line == "" {
+				continue
+			}
+			header = true
+			continue
+		}
+		if !header {
+			if line != "" {
+				st.Output = append(st.Output, line)
+			}
+			continue
+		}
+		values := strings.Split(line, "\t")
+		row := make([]any, len(values))
+		for j, v := range values {
+			row[j] = mysqlValue(v, st.Columns, j)
+		}
+		st.Rows = append(st.Rows, row)
+	}
+}
+
+var mysqlUnescaper = strings.NewReplacer(`\\`, `\`, `\t`, "\t", `\n`, "\n", `\0`, "\x00")
+
+func mysqlValue(v string, columns []SQLColumn, j int) any {
+	if v == "NULL" {
+		return nil
+	}
+	if j < len(columns) && mysqlNumericTypes[columns[j].Type] {
+		if _, err := strconv.ParseFloat(v, 64); err == nil {
+			return json.Number(v)
+		}
+	}
+	return mysqlUnescaper.Replace(v)
+}
+
+func newNonce(prefix string) (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
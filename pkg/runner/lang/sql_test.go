@@ -0,0 +1,134 @@
+package lang
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zetaoss/runbox/pkg/runner/box"
+	"github.com/zetaoss/runbox/pkg/testutil"
+)
+
+func TestSplitSQL(t *testing.T) {
+	testCases := []struct {
+		dialect string
+		source  string
+		want    []string
+	}{
+		{dialectSQLite3, "SELECT 1; SELECT 2;", []string{"SELECT 1", "SELECT 2"}},
+		{dialectSQLite3, "SELECT 'a;b', \"c;d\"; -- x;y\nSELECT 2", []string{`SELECT 'a;b', "c;d"`, "-- x;y\nSELECT 2"}},
+		{dialectSQLite3, "SELECT 'it''s;'; /* ; */ SELECT 2;\n-- trailing", []string{"SELECT 'it''s;'", "/* ; */ SELECT 2"}},
+		{dialectSQLite3, ".tables\nSELECT 1;\n.schema t", []string{".tables", "SELECT 1", ".schema t"}},
+		{
+			dialectSQLite3,
+			"CREATE TRIGGER tr AFTER INSERT ON t BEGIN\n  UPDATE t SET x = CASE WHEN 1 THEN 2 END;\n  DELETE FROM u;\nEND;\nSELECT 1;",
+			[]string{"CREATE TRIGGER tr AFTER INSERT ON t BEGIN\n  UPDATE t SET x = CASE WHEN 1 THEN 2 END;\n  DELETE FROM u;\nEND", "SELECT 1"},
+		},
+		{dialectSQLite3, "BEGIN; INSERT INTO t VALUES (1); END;", []string{"BEGIN", "INSERT INTO t VALUES (1)", "END"}},
+		{dialectMySQL, `SELECT 'a\';b'; # c;d` + "\nSELECT `x;y` FROM t", []string{`SELECT 'a\';b'`, "# c;d\nSELECT `x;y` FROM t"}},
+		{
+			dialectMySQL,
+			"DELIMITER //\nCREATE PROCEDURE p() BEGIN SELECT 1; SELECT 2; END//\nDELIMITER ;\nCALL p();",
+			[]string{"CREATE PROCEDURE p() BEGIN SELECT 1; SELECT 2; END", "CALL p()"},
+		},
+		{dialectMySQL, "-- only a comment\n;;", nil},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.dialect, tc.source), func(t *testing.T) {
+			require.Equal(t, tc.want, splitSQL(tc.source, tc.dialect))
+		})
+	}
+}
+
+func TestParseSQLite(t *testing.T) {
+	stmts := []string{"INSERT INTO t VALUES (1, 'a'), (2, NULL)", ".tables", "SELECT * FROM t", "SELECT * FROM nope", "SELEC 1"}
+	output := `@sql-1 changes -1 3
+@sql-1 stmt 0
+Run Time: real 0.002 user 0.000545 sys 0.000000
+@sql-1 changes 0 5
+@sql-1 stmt 1
+t
+@sql-1 changes 1 5
+@sql-1 stmt 2
+[{"id":1,"name":"a","score":1.5},
+{"id":2,"name":null,"score":null}]
+Run Time: real 0.001 user 0.000028 sys 0.000000
+@sql-1 changes 2 5
+@sql-1 stmt 3
+Parse error near line 45: no such table: nope
+Run Time: real 0.000 user 0.000014 sys 0.000000
+@sql-1 changes 3 5
+@sql-1 stmt 4
+Parse error near line 81: near "SELEC": syntax error
+  SELEC 1 ;
+  ^--- error here
+@sql-1 changes 4 5`
+	got, rest := parseSQLite("@sql-1", stmts, strings.Split(output, "\n"))
+	require.Empty(t, rest)
+	want := &SQLResult{Statements: []SQLStatement{
+		{SQL: stmts[0], Affected: 2, Time: 2},
+		{SQL: stmts[1], Output: []string{"t"}},
+		{
+			SQL:     stmts[2],
+			Columns: []SQLColumn{{Name: "id", Type: "INTEGER"}, {Name: "name", Type: "TEXT"}, {Name: "score", Type: "REAL"}},
+			Rows:    [][]any{{json.Number("1"), "a", json.Number("1.5")}, {json.Number("2"), nil, nil}},
+			Time:    1,
+		},
+		{SQL: stmts[3], Error: "Parse error: no such table: nope"},
+		{SQL: stmts[4], Error: "Parse error: near \"SELEC\": syntax error\n  SELEC 1 ;\n  ^--- error here"},
+	}}
+	require.Equal(t, want, got)
+}
+
+func TestParseMySQL(t *testing.T) {
+	stmts := []string{"SELECT id, name FROM t", "UPDATE t SET name = 'x'", "SELECT * FROM nope"}
+	nonce := "@sql-1"
+	marker := func(line string) string {
+		return "Field   1:  `" + nonce + "`\nCatalog:    `def`\nType:       VAR_STRING\n\n" + nonce + "\n" + line
+	}
+	output := strings.Join([]string{
+		"mysqld is ready",
+		marker(nonce + " stmt 0 1700000000.000000"),
+		"Field   1:  `id`\nCatalog:    `def`\nType:       LONG\nFlags:      NOT_NULL PRI_KEY\n",
+		"Field   2:  `name`\nCatalog:    `def`\nType:       VAR_STRING\n",
+		"id\tname",
+		"1\ta\\tb",
+		"2\tNULL",
+		marker(nonce + " done 0 -1 1700000000.002500"),
+		marker(nonce + " stmt 1 1700000000.003000"),
+		marker(nonce + " done 1 2 1700000000.004000"),
+		marker(nonce + " stmt 2 1700000000.005000"),
+		"ERROR 1146 (42S02) at line 10: Table 'db.nope' doesn't exist",
+		marker(nonce + " done 2 -1 1700000000.005000"),
+	}, "\n")
+	got, rest := parseMySQL(nonce, stmts, strings.Split(output, "\n"))
+	require.Equal(t, []string{"mysqld is ready"}, rest)
+	require.Len(t, got.Statements, 3)
+	require.Equal(t, []SQLColumn{{Name: "id", Type: "LONG"}, {Name: "name", Type: "VAR_STRING"}}, got.Statements[0].Columns)
+	require.Equal(t, [][]any{{json.Number("1"), "a\tb"}, {json.Number("2"), nil}}, got.Statements[0].Rows)
+	require.Equal(t, int64(0), got.Statements[0].Affected)
+	require.InDelta(t, 2.5, got.Statements[0].Time, 0.01)
+	require.Equal(t, int64(2), got.Statements[1].Affected)
+	require.Nil(t, got.Statements[1].Columns)
+	require.Equal(t, "ERROR 1146 (42S02) at line 10: Table 'db.nope' doesn't exist", got.Statements[2].Error)
+}
+
+func TestSQLScript(t *testing.T) {
+	require.Equal(t, ".bail off\n"+
+		".timer off\n.headers off\n.mode list\nSELECT '@sql-1 changes -1 ' || total_changes();\n"+
+		".print @sql-1 stmt 0\n.mode json\n.timer on\nSELECT 1 -- x\n;\n"+
+		".timer off\n.headers off\n.mode list\nSELECT '@sql-1 changes 0 ' || total_changes();\n",
+		sqliteScript("@sql-1", []string{"SELECT 1 -- x"}))
+	require.Equal(t, "DELIMITER $$1\n"+
+		"SELECT CONCAT('@sql-1 stmt 0 ', UNIX_TIMESTAMP(NOW(6))) AS `@sql-1`$$1\n"+
+		"SELECT 1; SELECT 2\n$$1\n"+
+		"SELECT CONCAT('@sql-1 done 0 ', ROW_COUNT(), ' ', UNIX_TIMESTAMP(NOW(6))) AS `@sql-1`$$1\n",
+		mysqlScript("@sql-1", []string{"SELECT 1; SELECT 2"}))
+}
+
+func TestRunSQL_unsupported(t *testing.T) {
+	l := &Lang{registry: Builtin()}
+	_, _, err := l.RunSQL(Input{Lang: "python", Files: []box.File{{Body: "print(1)"}}}, box.RunOptions{})
+	require.EqualError(t, err, "unsupported: sql results for python")
+}
@@ -0,0 +1,134 @@
+package lang
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zetaoss/runbox/pkg/apperror"
+)
+
+const (
+	defaultTeXDPI = 72
+	minTeXDPI     = 36
+	maxTeXDPI     = 600
+)
+
+// TeXOptions picks the engine of a LaTeX build and how its pages are
+// rendered to images. Pages is a 1-based list such as "1-3,5".
+type TeXOptions struct {
+	Engine string `json:"engine,omitempty"`
+	DPI    int    `json:"dpi,omitempty"`
+	Pages  string `json:"pages,omitempty"`
+}
+
+// latexmk flags for each engine; the first is the default.
+var texEngines = map[string]string{
+	"pdflatex": "-pdf",
+	"xelatex":  "-pdfxe",
+	"lualatex": "-pdflua",
+}
+
+var texPagesPattern = regexp.MustCompile(`^\d+(-\d+)?(,\d+(-\d+)?)*$`)
+
+// texCommand fills in the {{engine}}, {{dpi}} and {{pages}} placeholders.
+func texCommand(command string, o TeXOptions) (string, error) {
+	engine := o.Engine
+	if engine == "" {
+		engine = "pdflatex"
+	}
+	flag, ok := texEngines[engine]
+	if !ok {
+		return "", fmt.Errorf("%w: tex engine '%s' not supported", apperror.ErrInvalidArgs, engine)
+	}
+	dpi := o.DPI
+	if dpi == 0 {
+		dpi = defaultTeXDPI
+	}
+	if dpi < minTeXDPI || dpi > maxTeXDPI {
+		return "", fmt.Errorf("%w: tex dpi must be between %d and %d", apperror.ErrInvalidArgs, minTeXDPI, maxTeXDPI)
+	}
+	pages, err := texPages(o.Pages)
+	if err != nil {
+		return "", err
+	}
+	return strings.NewReplacer(
+		placeholder("engine"), flag,
+		placeholder("dpi"), strconv.Itoa(dpi),
+		placeholder("pages"), shellWord("runbox.pdf"+pages),
+	).Replace(command), nil
+}
+
+// texPages turns 1-based page ranges into ImageMagick's 0-based frame
+// selection, e.g. "1-3,5" into "[0-2,4]".
+func texPages(pages string) (string, error) {
+	if pages == "" {
+		return "", nil
+	}
+	if !texPagesPattern.MatchString(pages) {
+		return "", fmt.Errorf("%w: invalid tex pages '%s'", apperror.ErrInvalidArgs, pages)
+	}
+	var ranges []string
+	for _, r := range strings.Split(pages, ",") {
+		from, to, isRange := strings.Cut(r, "-")
+		a, _ := strconv.Atoi(from)
+		b := a
+		if isRange {
+			b, _ = strconv.Atoi(to)
+		}
+		if a < 1 || b < a {
+			return "", fmt.Errorf("%w: invalid tex pages '%s'", apperror.ErrInvalidArgs, pages)
+		}
+		if a == b {
+			ranges = append(ranges, strconv.Itoa(a-1))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", a-1, b-1))
+		}
+	}
+	return "[" + strings.Join(ranges, ",") + "]", nil
+}
+
+var (
+	// ./runbox.tex:5: Undefined control sequence.
+	texFileLinePattern = regexp.MustCompile(`^(\S+?\.(?:tex|sty|cls|bbl|ltx)):(\d+): (.*)$`)
+	// ! Undefined control sequence.
+	texErrorPattern = regexp.MustCompile(`^! (.*)$`)
+	// l.5 \foo
+	texLinePattern = regexp.MustCompile(`^l\.(\d+) `)
+	// LaTeX Warning: Reference `x' on page 1 undefined on input line 7.
+	texWarningPattern = regexp.MustCompile(`^(?:LaTeX|Package \S+|Class \S+) Warning: (.*?)(?: on input line (\d+))?\.?$`)
+	// Overfull \hbox (12.0pt too wide) in paragraph at lines 5--6
+	texBoxPattern = regexp.MustCompile(`^((?:Over|Under)full \\[hv]box .*?) (?:in paragraph |in alignment |detected )?at lines? (\d+)`)
+)
+
+// parseTeXLog reads errors and warnings from a TeX .log file. Errors
+// without a file name are in the main file.
+func parseTeXLog(lines []string) []Diagnostic {
+	var ds []Diagnostic
+	for i, l := range lines {
+		if m := texFileLinePattern.FindStringSubmatch(l); m != nil {
+			ds = append(ds, Diagnostic{File: m[1], Line: atoi(m[2]), Severity: "error", Message: m[3]})
+			continue
+		}
+		if m := texErrorPattern.FindStringSubmatch(l); m != nil && m[1] != "Emergency stop." {
+			d := Diagnostic{File: "runbox.tex", Severity: "error", Message: m[1]}
+			for _, next := range lines[i+1 : min(i+10, len(lines))] {
+				if lm := texLinePattern.FindStringSubmatch(next); lm != nil {
+					d.Line = atoi(lm[1])
+					break
+				}
+			}
+			ds = append(ds, d)
+			continue
+		}
+		if m := texWarningPattern.FindStringSubmatch(l); m != nil {
+			ds = append(ds, Diagnostic{File: "runbox.tex", Line: atoi(m[2]), Severity: "warning", Message: m[1]})
+			continue
+		}
+		if m := texBoxPattern.FindStringSubmatch(l); m != nil {
+			ds = append(ds, Diagnostic{File: "runbox.tex", Line: atoi(m[2]), Severity: "warning", Message: m[1]})
+		}
+	}
+	return ds
+}
@@ -0,0 +1,77 @@
+package lang
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zetaoss/runbox/pkg/runner/box"
+	"github.com/zetaoss/runbox/pkg/testutil"
+)
+
+func TestTeXCommand(t *testing.T) {
+	r := Builtin()
+	testCases := []struct {
+		tex       *TeXOptions
+		want      string
+		wantError string
+	}{
+		{
+			nil,
+			"touch oblivoir.sty && latexmk -pdf -interaction=nonstopmode -halt-on-error -file-line-error -bibtex runbox.tex && convert -density 72 runbox.pdf -strip page-%03d.png",
+			"",
+		},
+		{
+			&TeXOptions{Engine: "xelatex", DPI: 150, Pages: "1-3,5"},
+			"touch oblivoir.sty && latexmk -pdfxe -interaction=nonstopmode -halt-on-error -file-line-error -bibtex runbox.tex && convert -density 150 'runbox.pdf[0-2,4]' -strip page-%03d.png",
+			"",
+		},
+		{&TeXOptions{Engine: "tex"}, "", "invalid args: tex engine 'tex' not supported"},
+		{&TeXOptions{DPI: 1200}, "", "invalid args: tex dpi must be between 36 and 600"},
+		{&TeXOptions{Pages: "3-1"}, "", "invalid args: invalid tex pages '3-1'"},
+		{&TeXOptions{Pages: "0"}, "", "invalid args: invalid tex pages '0'"},
+		{&TeXOptions{Pages: "1;rm"}, "", "invalid args: invalid tex pages '1;rm'"},
+	}
+	for i, tc := range testCases {
+		t.Run(testutil.Name(i, tc.want), func(t *testing.T) {
+			got, err := toLangOpts(r, Input{Lang: "latex", Files: []box.File{{Body: "x"}}, TeX: tc.tex})
+			if tc.wantError != "" {
+				require.EqualError(t, err, tc.wantError)
+				return
+			}
+			require.NoError(t, err)
+			opts := toBoxOpts(*got)
+			require.Equal(t, tc.want, opts.Command)
+			require.Equal(t, []string{"runbox.pdf", "runbox.log"}, opts.Artifacts)
+			require.Equal(t, int64(1024*1024), opts.MaxImageBytes)
+		})
+	}
+
+	_, err := toLangOpts(r, Input{Lang: "python", Files: []box.File{{Body: "x"}}, TeX: &TeXOptions{}})
+	require.EqualError(t, err, "invalid args: tex options not supported for python")
+}
+
+func TestTeXDiagnostics(t *testing.T) {
+	l := &Lang{registry: Builtin()}
+	log := "This is pdfTeX, Version 3.141592653-2.6-1.40.25\n" +
+		"./runbox.tex:5: Undefined control sequence.\n" +
+		"l.5 \\foo\n" +
+		"! Missing $ inserted.\n" +
+		"<inserted text>\n" +
+		"l.9 a_\n" +
+		"! Emergency stop.\n" +
+		"LaTeX Warning: Reference `fig' on page 1 undefined on input line 7.\n" +
+		"Package hyperref Warning: Token not allowed in a PDF string.\n" +
+		"Overfull \\hbox (12.0pt too wide) in paragraph at lines 11--12\n"
+	result := &box.Result{
+		Logs:      []box.Log{{Stream: 1, Log: "./runbox.tex:1: not from the log"}},
+		Artifacts: []box.Artifact{{Name: "runbox.log", Base64: base64.StdEncoding.EncodeToString([]byte(log))}},
+	}
+	require.Equal(t, []Diagnostic{
+		{File: "runbox.tex", Line: 5, Severity: "error", Message: "Undefined control sequence."},
+		{File: "runbox.tex", Line: 9, Severity: "error", Message: "Missing $ inserted."},
+		{File: "runbox.tex", Line: 7, Severity: "warning", Message: "Reference `fig' on page 1 undefined"},
+		{File: "runbox.tex", Severity: "warning", Message: "Token not allowed in a PDF string"},
+		{File: "runbox.tex", Line: 11, Severity: "warning", Message: "Overfull \\hbox (12.0pt too wide)"},
+	}, l.Diagnostics(Input{Lang: "latex", Files: []box.File{{Body: "x"}}}, result))
+}
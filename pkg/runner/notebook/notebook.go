@@ -18,7 +18,7 @@ func New(box *box.Box) *Notebook {
 	return &Notebook{box}
 }
 
-func (n *Notebook) Run(input Input) (*Result, error) {
+func (n *Notebook) Run(input Input, runOpts box.RunOptions) (*Result, error) {
 	fileBody, err := toFileBody(input)
 	if err != nil {
 		if err == apperror.ErrInvalidLanguage {
@@ -37,6 +37,9 @@ func (n *Notebook) Run(input Input) (*Result, error) {
 		Image:         fmt.Sprintf("jmnote/runbox:%s-notebook", input.Lang),
 		WorkingDir:    "/tmp",
 	}
+	if err := runOpts.Apply(opts, n.box.Limits()); err != nil {
+		return nil, err
+	}
 	boxResult, err := n.box.Run(opts)
 	if err != nil {
 		return nil, fmt.Errorf("run err: %w", err)
@@ -49,7 +49,7 @@ func TestRun_error(t *testing.T) {
 	}
 	for i, tc := range testCases {
 		t.Run(testutil.Name(i, tc.input), func(t *testing.T) {
-			got, err := notebook1.Run(tc.input)
+			got, err := notebook1.Run(tc.input, box.RunOptions{})
 			require.EqualError(t, err, tc.wantError)
 			require.Nil(t, got)
 		})
@@ -175,7 +175,7 @@ func TestRun_ok(t *testing.T) {
 	}
 	for i, tc := range testCases {
 		t.Run(testutil.Name(i, tc.input), func(t *testing.T) {
-			got, err := notebook1.Run(tc.input)
+			got, err := notebook1.Run(tc.input, box.RunOptions{})
 			require.NoError(t, err)
 			equalResult(t, tc.want, got)
 		})